@@ -0,0 +1,340 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config 服务配置，优先级：默认值 < config.yaml < 环境变量 < 命令行参数
+// 时长在 yaml 中写成 "30s"、"10m" 的形式
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Stream   StreamConfig   `yaml:"stream"`
+	Bus      BusConfig      `yaml:"bus"`
+	Auth     AuthConfig     `yaml:"auth"`
+	LLM      LLMConfig      `yaml:"llm"`
+}
+
+// ServerConfig HTTP 服务配置
+type ServerConfig struct {
+	Addr              string        `yaml:"addr"`                // 监听地址，SERVER_ADDR / -addr
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"` // 读取请求头的超时时间
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`    // 停止时等待生成结束的最长时间，SHUTDOWN_TIMEOUT_SECONDS
+}
+
+// DatabaseConfig MySQL 配置
+type DatabaseConfig struct {
+	DSN             string        `yaml:"dsn"` // 必填，DATABASE_DSN / -dsn
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// StreamConfig 流式生成与推送配置
+type StreamConfig struct {
+	LagWindow         int            `yaml:"lag_window"`         // 客户端落后超过该chunk数时断开，STREAM_LAG_WINDOW
+	HeartbeatInterval time.Duration  `yaml:"heartbeat_interval"` // 心跳间隔，STREAM_HEARTBEAT_SECONDS
+	IdleTimeout       time.Duration  `yaml:"idle_timeout"`       // 生成超过该时间没有新chunk时中断，STREAM_IDLE_TIMEOUT_SECONDS
+	RetryHint         time.Duration  `yaml:"retry_hint"`         // EventSource 重连间隔，STREAM_RETRY_MS
+	Janitor           JanitorConfig  `yaml:"janitor"`
+	ChunkLog          ChunkLogConfig `yaml:"chunk_log"`
+}
+
+// ChunkLogConfig chunk日志批量写入配置：chunk先缓存，到期或积累到一定字节数时一次写入，流结束时写入剩余部分
+// 进程异常退出时最多丢失一个批次，重启后从日志恢复的内容可能比客户端已收到的少
+type ChunkLogConfig struct {
+	FlushInterval time.Duration `yaml:"flush_interval"` // 第一个未写入的chunk最多缓存的时间，STREAM_CHUNK_LOG_FLUSH_MS
+	FlushBytes    int           `yaml:"flush_bytes"`    // 缓存的内容达到该字节数时立即写入，STREAM_CHUNK_LOG_FLUSH_BYTES
+}
+
+// JanitorConfig 流清理配置
+type JanitorConfig struct {
+	Interval     time.Duration `yaml:"interval"`      // 扫描间隔，STREAM_JANITOR_INTERVAL_SECONDS
+	CompletedTTL time.Duration `yaml:"completed_ttl"` // 已结束的流在内存中保留的时间，STREAM_COMPLETED_TTL_SECONDS
+	AbandonedTTL time.Duration `yaml:"abandoned_ttl"` // 流未配置空闲超时时使用，为 0 时取 stream.idle_timeout，STREAM_ABANDONED_TTL_SECONDS
+}
+
+// BusConfig 跨实例流事件总线配置
+type BusConfig struct {
+	Type       string      `yaml:"type"`        // memory / redis，STREAM_BUS
+	InstanceID string      `yaml:"instance_id"` // 实例标识，重启后应保持不变，默认取主机名，INSTANCE_ID / -instance-id
+	Redis      RedisConfig `yaml:"redis"`
+}
+
+// RedisConfig Redis 总线配置
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`     // REDIS_ADDR
+	Password string `yaml:"password"` // REDIS_PASSWORD
+	DB       int    `yaml:"db"`       // REDIS_DB
+	Prefix   string `yaml:"prefix"`   // REDIS_PREFIX
+
+	OwnerTTL  time.Duration `yaml:"owner_ttl"`  // 生成所在实例标记的有效期，每次发布事件时续期
+	StreamTTL time.Duration `yaml:"stream_ttl"` // 事件流保留时间，供其它实例续传
+}
+
+// AuthConfig 认证与授权配置，JWT 密钥至少配置一种
+type AuthConfig struct {
+	HS256Secret        string              `yaml:"hs256_secret"`          // JWT_HS256_SECRET
+	RS256PublicKeyFile string              `yaml:"rs256_public_key_file"` // JWT_RS256_PUBLIC_KEY_FILE
+	JWKSFile           string              `yaml:"jwks_file"`             // JWT_JWKS_FILE
+	RoleMatrixFile     string              `yaml:"role_matrix_file"`      // JSON 格式的角色矩阵，AUTH_ROLE_MATRIX_FILE
+	RoleMatrix         map[string][]string `yaml:"role_matrix"`           // 权限 -> 角色，覆盖文件和默认配置中的同名权限
+}
+
+// LLMConfig 大模型配置
+type LLMConfig struct {
+	DefaultProvider  string       `yaml:"default_provider"` // 项目没有指定 provider 时使用，LLM_DEFAULT_PROVIDER
+	OpenAI           OpenAIConfig `yaml:"openai"`
+	TokenizerBPEFile string       `yaml:"tokenizer_bpe_file"` // 本地 BPE 词表，未配置时使用启发式分词器，TOKENIZER_BPE_FILE
+}
+
+// OpenAIConfig OpenAI 兼容服务的默认配置，项目的模型服务配置可以覆盖
+type OpenAIConfig struct {
+	BaseURL     string   `yaml:"base_url"`    // OPENAI_BASE_URL
+	Model       string   `yaml:"model"`       // OPENAI_MODEL
+	APIKey      string   `yaml:"api_key"`     // OPENAI_API_KEY
+	Temperature *float64 `yaml:"temperature"` // 为空时不传，由模型服务决定，OPENAI_TEMPERATURE
+	MaxTokens   int      `yaml:"max_tokens"`  // 为 0 时不传，OPENAI_MAX_TOKENS
+
+	// 项目可以改用的服务地址前缀，项目的 base_url 不在其中时拒绝调用；为空表示项目不能修改 base_url
+	AllowedBaseURLs []string `yaml:"allowed_base_urls"`
+
+	// 流式响应可能持续很久，只限制建立连接和等待响应头的时间，读取响应体由生成的上下文和空闲超时控制
+	DialTimeout           time.Duration `yaml:"dial_timeout"`            // 建立连接的超时时间
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"` // 发出请求后等待响应头的超时时间
+}
+
+// Default 默认配置
+func Default() *Config {
+	instanceID, err := os.Hostname()
+	if err != nil || instanceID == "" {
+		instanceID = "local"
+	}
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    50,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: time.Hour,
+		},
+		Stream: StreamConfig{
+			LagWindow:         2000,
+			HeartbeatInterval: 15 * time.Second,
+			IdleTimeout:       10 * time.Minute,
+			RetryHint:         3 * time.Second,
+			Janitor: JanitorConfig{
+				Interval:     30 * time.Second,
+				CompletedTTL: 2 * time.Minute,
+			},
+			ChunkLog: ChunkLogConfig{
+				FlushInterval: 500 * time.Millisecond,
+				FlushBytes:    4096,
+			},
+		},
+		Bus: BusConfig{
+			Type:       "memory",
+			InstanceID: instanceID,
+			Redis: RedisConfig{
+				OwnerTTL:  10 * time.Minute,
+				StreamTTL: 30 * time.Minute,
+			},
+		},
+		LLM: LLMConfig{
+			DefaultProvider: "openai",
+			OpenAI: OpenAIConfig{
+				BaseURL: "https://api.openai.com",
+				Model:   "gpt-4o-mini",
+
+				DialTimeout:           10 * time.Second,
+				ResponseHeaderTimeout: 2 * time.Minute,
+			},
+		},
+	}
+}
+
+// Load 按优先级加载配置并校验，args 为命令行参数（不含程序名）
+// -config 指定的文件不存在时报错，默认的 config.yaml 不存在时忽略
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("session-management", flag.ContinueOnError)
+	path := fs.String("config", "config.yaml", "path to config file")
+	addr := fs.String("addr", "", "listen address, overrides server.addr")
+	dsn := fs.String("dsn", "", "MySQL DSN, overrides database.dsn")
+	instanceID := fs.String("instance-id", "", "instance id, overrides bus.instance_id")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	cfg := Default()
+	if err := cfg.loadFile(*path, explicit["config"]); err != nil {
+		return nil, err
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if explicit["addr"] {
+		cfg.Server.Addr = *addr
+	}
+	if explicit["dsn"] {
+		cfg.Database.DSN = *dsn
+	}
+	if explicit["instance-id"] {
+		cfg.Bus.InstanceID = *instanceID
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile 用 yaml 文件覆盖配置，空文件视为没有配置
+func (c *Config) loadFile(path string, required bool) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := yaml.NewDecoder(f).Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv 用环境变量覆盖配置，变量名沿用之前各模块读取的名称
+func (c *Config) applyEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	integer := func(name string, dst *int) bool {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return false
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			return false
+		}
+		*dst = n
+		return true
+	}
+	float := func(name string, dst **float64) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			return
+		}
+		*dst = &f
+	}
+	duration := func(name string, unit time.Duration, dst *time.Duration) {
+		var n int
+		if integer(name, &n) {
+			*dst = time.Duration(n) * unit
+		}
+	}
+
+	str("SERVER_ADDR", &c.Server.Addr)
+	duration("SHUTDOWN_TIMEOUT_SECONDS", time.Second, &c.Server.ShutdownTimeout)
+
+	str("DATABASE_DSN", &c.Database.DSN)
+
+	integer("STREAM_LAG_WINDOW", &c.Stream.LagWindow)
+	duration("STREAM_HEARTBEAT_SECONDS", time.Second, &c.Stream.HeartbeatInterval)
+	duration("STREAM_IDLE_TIMEOUT_SECONDS", time.Second, &c.Stream.IdleTimeout)
+	duration("STREAM_RETRY_MS", time.Millisecond, &c.Stream.RetryHint)
+	duration("STREAM_JANITOR_INTERVAL_SECONDS", time.Second, &c.Stream.Janitor.Interval)
+	duration("STREAM_COMPLETED_TTL_SECONDS", time.Second, &c.Stream.Janitor.CompletedTTL)
+	duration("STREAM_ABANDONED_TTL_SECONDS", time.Second, &c.Stream.Janitor.AbandonedTTL)
+	duration("STREAM_CHUNK_LOG_FLUSH_MS", time.Millisecond, &c.Stream.ChunkLog.FlushInterval)
+	integer("STREAM_CHUNK_LOG_FLUSH_BYTES", &c.Stream.ChunkLog.FlushBytes)
+
+	str("STREAM_BUS", &c.Bus.Type)
+	str("INSTANCE_ID", &c.Bus.InstanceID)
+	str("REDIS_ADDR", &c.Bus.Redis.Addr)
+	str("REDIS_PASSWORD", &c.Bus.Redis.Password)
+	integer("REDIS_DB", &c.Bus.Redis.DB)
+	str("REDIS_PREFIX", &c.Bus.Redis.Prefix)
+
+	str("JWT_HS256_SECRET", &c.Auth.HS256Secret)
+	str("JWT_RS256_PUBLIC_KEY_FILE", &c.Auth.RS256PublicKeyFile)
+	str("JWT_JWKS_FILE", &c.Auth.JWKSFile)
+	str("AUTH_ROLE_MATRIX_FILE", &c.Auth.RoleMatrixFile)
+
+	str("LLM_DEFAULT_PROVIDER", &c.LLM.DefaultProvider)
+	str("OPENAI_BASE_URL", &c.LLM.OpenAI.BaseURL)
+	str("OPENAI_MODEL", &c.LLM.OpenAI.Model)
+	str("OPENAI_API_KEY", &c.LLM.OpenAI.APIKey)
+	float("OPENAI_TEMPERATURE", &c.LLM.OpenAI.Temperature)
+	integer("OPENAI_MAX_TOKENS", &c.LLM.OpenAI.MaxTokens)
+	str("TOKENIZER_BPE_FILE", &c.LLM.TokenizerBPEFile)
+
+	return errors.Join(errs...)
+}
+
+// Validate 校验必填项和取值范围，返回所有不合法的配置
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Database.DSN != "", "database.dsn is required")
+
+	check(c.Stream.LagWindow > 0, "stream.lag_window must be positive")
+	check(c.Stream.HeartbeatInterval > 0, "stream.heartbeat_interval must be positive")
+	check(c.Stream.IdleTimeout > 0, "stream.idle_timeout must be positive")
+	check(c.Stream.RetryHint > 0, "stream.retry_hint must be positive")
+	check(c.Stream.Janitor.Interval > 0, "stream.janitor.interval must be positive")
+	check(c.Stream.Janitor.CompletedTTL >= 0, "stream.janitor.completed_ttl must not be negative")
+	check(c.Stream.Janitor.AbandonedTTL >= 0, "stream.janitor.abandoned_ttl must not be negative")
+	check(c.Stream.ChunkLog.FlushInterval > 0, "stream.chunk_log.flush_interval must be positive")
+	check(c.Stream.ChunkLog.FlushBytes > 0, "stream.chunk_log.flush_bytes must be positive")
+
+	switch c.Bus.Type {
+	case "memory":
+	case "redis":
+		check(c.Bus.Redis.Addr != "", "bus.redis.addr is required when bus.type is redis")
+	default:
+		errs = append(errs, fmt.Errorf("bus.type must be memory or redis, got %q", c.Bus.Type))
+	}
+	check(c.Bus.InstanceID != "", "bus.instance_id is required")
+
+	check(c.Auth.HS256Secret != "" || c.Auth.RS256PublicKeyFile != "" || c.Auth.JWKSFile != "",
+		"one of auth.hs256_secret, auth.rs256_public_key_file or auth.jwks_file is required")
+
+	check(c.LLM.DefaultProvider != "", "llm.default_provider is required")
+	check(c.LLM.OpenAI.BaseURL != "", "llm.openai.base_url is required")
+	check(c.LLM.OpenAI.MaxTokens >= 0, "llm.openai.max_tokens must not be negative")
+	check(c.LLM.OpenAI.DialTimeout > 0, "llm.openai.dial_timeout must be positive")
+	check(c.LLM.OpenAI.ResponseHeaderTimeout > 0, "llm.openai.response_header_timeout must be positive")
+
+	return errors.Join(errs...)
+}
@@ -5,6 +5,8 @@ var (
 	RoleUser = "user"
 	// RoleAssistant 助手角色
 	RoleAssistant = "assistant"
+	// RoleSystem 系统指令角色
+	RoleSystem = "system"
 
 	// MessageStatusCompleted 消息完成状态
 	MessageStatusCompleted = "COMPLETED"
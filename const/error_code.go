@@ -10,11 +10,15 @@ var (
 	ErrInternalServer = &response.BizError{HttpStatus: http.StatusInternalServerError, Code: 500, Msg: "Internal Server Error"}
 	// 认证错误
 	ErrUnauthorized = &response.BizError{HttpStatus: http.StatusUnauthorized, Code: 401, Msg: "Unauthorized"}
+	// 权限不足
+	ErrForbidden = &response.BizError{HttpStatus: http.StatusForbidden, Code: 403, Msg: "Forbidden"}
 
 	// 请求错误
 	ErrBadRequest = &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "Bad Request"}
 	// 流不存在错误
 	ErrStreamNotFound = &response.BizError{HttpStatus: http.StatusNotFound, Code: 404, Msg: "Stream Not Found"}
+	// 流已超过续传保留期，chunk日志已清理，客户端应重新获取消息
+	ErrStreamExpired = &response.BizError{HttpStatus: http.StatusGone, Code: 410, Msg: "Stream Expired, Refetch The Message"}
 
 	// 项目ID不匹配错误
 	ErrProjectIDNotMatch = &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "Project ID Not Match"}
@@ -25,6 +29,9 @@ var (
 	// 创建消息错误
 	ErrCreateMessageError = &response.BizError{HttpStatus: http.StatusInternalServerError, Code: 500, Msg: "Create Message Error"}
 
+	// API key 不存在
+	ErrAPIKeyNotFound = &response.BizError{HttpStatus: http.StatusNotFound, Code: 404, Msg: "API Key Not Found"}
+
 	// 无效的消息ID错误
 	ErrInvalidMessageID = &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "Invalid Message ID"}
 )
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"session-management/config"
+	"session-management/dao"
+	"session-management/handler"
+	"session-management/pkg/auth"
+	"session-management/pkg/streambus"
+	"session-management/pkg/tokenizer"
+	"session-management/service"
+
+	"gorm.io/gorm"
+)
+
+// Container 应用的依赖：一个数据库连接池，以及在其上构造的 DAO、服务、认证和接口
+type Container struct {
+	DAO  *dao.UniDAO
+	Auth *auth.Authenticator
+
+	Providers  *service.ProviderRegistry
+	Tokenizers *tokenizer.Registry
+
+	Projects *service.ProjectService
+	Sessions *service.SessionService
+	Messages *service.MessageService
+	APIKeys  *service.APIKeyService
+	Streams  *service.StreamManager
+	Chat     *service.ChatService
+
+	ProjectHandler *handler.ProjectHandler
+	SessionHandler *handler.SessionHandler
+	MessageHandler *handler.MessageHandler
+	AdminHandler   *handler.AdminHandler
+	APIKeyHandler  *handler.APIKeyHandler
+}
+
+// NewContainer 按配置连接数据库和流事件总线，依次构造服务、认证和接口
+func NewContainer(cfg *config.Config) (*Container, error) {
+	// 先加载密钥，认证配置有误时不必连接数据库
+	keys, err := auth.LoadKeySet(auth.KeyConfig{
+		HMACSecret:       cfg.Auth.HS256Secret,
+		RSAPublicKeyFile: cfg.Auth.RS256PublicKeyFile,
+		JWKSFile:         cfg.Auth.JWKSFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("加载认证配置失败: %w", err)
+	}
+	matrix, err := auth.BuildRoleMatrix(cfg.Auth.RoleMatrixFile, cfg.Auth.RoleMatrix)
+	if err != nil {
+		return nil, fmt.Errorf("加载认证配置失败: %w", err)
+	}
+
+	db, err := dao.OpenDB(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	bus, err := service.NewStreamBus(cfg.Bus, cfg.Stream.LagWindow)
+	if err != nil {
+		return nil, err
+	}
+	return newContainer(cfg, db, bus, keys, matrix)
+}
+
+// newContainer 在已连接的数据库和总线上构造模型提供方、服务、认证和接口
+func newContainer(cfg *config.Config, db *gorm.DB, bus streambus.Bus, keys *auth.KeySet, matrix auth.RoleMatrix) (*Container, error) {
+	c := &Container{DAO: dao.NewUniDAO(db)}
+	c.Providers = service.NewProviderRegistry()
+	c.Providers.Register(service.NewOpenAIProviderFromConfig(cfg.LLM.OpenAI))
+	if err := c.Providers.SetDefault(cfg.LLM.DefaultProvider); err != nil {
+		return nil, fmt.Errorf("加载配置失败: %w", err)
+	}
+	c.Tokenizers = service.NewTokenizerRegistry(cfg.LLM.TokenizerBPEFile)
+
+	c.Projects = service.NewProjectService(db, c.DAO)
+	c.Sessions = service.NewSessionService(db, c.Projects)
+	c.Messages = service.NewMessageService(db, c.Sessions)
+	c.APIKeys = service.NewAPIKeyService(db)
+	c.Streams = service.NewStreamManager(c.Messages, bus, c.Tokenizers, cfg.Stream, cfg.Bus.InstanceID)
+	c.Chat = service.NewChatService(c.Projects, c.Sessions, c.Messages, c.Streams, c.Providers, c.Tokenizers)
+	// 个人 API key 由业务层校验
+	c.Auth = auth.NewAuthenticator(keys, matrix, c.APIKeys.ResolveAPIKey)
+
+	c.ProjectHandler = handler.NewProjectHandler(c.Projects, c.Sessions)
+	c.SessionHandler = handler.NewSessionHandler(c.Sessions, c.Messages, c.Chat)
+	c.MessageHandler = handler.NewMessageHandler(c.Sessions, c.Messages, c.Chat, c.Streams)
+	c.AdminHandler = handler.NewAdminHandler(c.Streams)
+	c.APIKeyHandler = handler.NewAPIKeyHandler(c.APIKeys, c.Sessions)
+	return c, nil
+}
@@ -1,7 +1,9 @@
 package dao
 
 import (
+	"fmt"
 	"log"
+	"session-management/config"
 	"session-management/models"
 
 	"gorm.io/driver/mysql"
@@ -13,39 +15,37 @@ type UniDAO struct {
 	db *gorm.DB
 }
 
-var AiAppUniDAO *UniDAO
-
-// 初始化
-func init() {
-	initDB()
-	log.Println("AiAppUniDAO initialized")
+// NewUniDAO 创建数据访问对象
+func NewUniDAO(db *gorm.DB) *UniDAO {
+	return &UniDAO{db: db}
 }
 
-// 初始化数据库
-func initDB() {
-
-	dsn := "gormuser:gorm123@tcp(127.0.0.1:3306)/gorm_test?charset=utf8mb4&parseTime=True&loc=Local"
-
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-
-	// dsn := "gormuser:gorm123@tcp(127.0.0.1:3306)/gorm_test?charset=utf8mb4&parseTime=True&loc=Local"
-
-	// 使用MySQL数据库（便于演示，生产环境请用MySQL/PostgreSQL）
-	// db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+// OpenDB 按配置连接数据库并迁移表结构，整个进程共用一个连接池
+func OpenDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(mysql.Open(cfg.DSN), &gorm.Config{})
 	if err != nil {
-		log.Fatal("数据库连接失败:", err)
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
 	}
-
-	// 自动迁移表结构
-	err = db.AutoMigrate(&models.Session{}, &models.Message{}, &models.Project{})
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatal("数据库迁移失败:", err)
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
 	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	// 创建一些测试数据
-	// createTestData()
-
-	log.Println("dao初始化完成1")
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+	log.Println("数据库初始化完成")
+	return db, nil
+}
 
-	AiAppUniDAO = &UniDAO{db: db}
+// Migrate 自动迁移表结构
+func Migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(&models.Session{}, &models.Message{}, &models.Project{}, &models.StreamChunkLog{}, &models.APIKey{})
+	if err != nil {
+		return fmt.Errorf("数据库迁移失败: %w", err)
+	}
+	return nil
 }
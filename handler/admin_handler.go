@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	constant "session-management/const"
+	"session-management/pkg/auth"
+	"session-management/response"
+	"session-management/service"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+// AdminHandler 管理接口
+type AdminHandler struct {
+	streams *service.StreamManager
+}
+
+// 创建管理接口
+func NewAdminHandler(streams *service.StreamManager) *AdminHandler {
+	return &AdminHandler{streams: streams}
+}
+
+// ListAllStreamsHandler 管理接口：查询本实例上的所有流
+func (h *AdminHandler) ListAllStreamsHandler(req *restful.Request, resp *restful.Response) {
+	response.WriteSuccess(resp, http.StatusOK, h.streams.ListAllStreams())
+}
+
+// ForceBreakStreamHandler 管理接口：强制中断任意流，不校验会话归属
+func (h *AdminHandler) ForceBreakStreamHandler(req *restful.Request, resp *restful.Response) {
+	sessionID := req.PathParameter("sessionId")
+	messageID := req.PathParameter("messageId")
+
+	exists, err := h.streams.BreakStream(sessionID, messageID)
+	if !exists {
+		response.WriteBizError(resp, constant.ErrStreamNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("ForceBreakStreamHandler error:", err)
+		response.WriteBizError(resp, constant.ErrInternalServer)
+		return
+	}
+	log.Printf("管理员 %s 强制中断流: %s_%s", auth.GetUserID(req), sessionID, messageID)
+
+	response.WriteSuccess(resp, http.StatusOK, nil)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+
+	constant "session-management/const"
+	"session-management/pkg/auth"
+	"session-management/requests"
+	"session-management/response"
+	"session-management/service"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+// APIKeyHandler 个人 API key 接口
+type APIKeyHandler struct {
+	apiKeys  *service.APIKeyService
+	sessions *service.SessionService
+}
+
+// 创建 API key 接口
+func NewAPIKeyHandler(apiKeys *service.APIKeyService, sessions *service.SessionService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeys: apiKeys, sessions: sessions}
+}
+
+// 签发个人 API key，明文只在响应中返回一次
+func (h *APIKeyHandler) CreateAPIKeyHandler(req *restful.Request, resp *restful.Response) {
+	reqBody, err := service.BindRequestBody[requests.CreateAPIKeyReq](req)
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	roles := auth.GetAuthContext(req).Roles()
+	result, err := h.apiKeys.CreateAPIKey(auth.GetUserID(req), roles, reqBody)
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	response.WriteSuccess(resp, http.StatusCreated, result)
+}
+
+// 查询个人 API key，不含明文
+func (h *APIKeyHandler) ListAPIKeysHandler(req *restful.Request, resp *restful.Response) {
+	keys, err := h.apiKeys.ListAPIKeys(auth.GetUserID(req))
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	response.WriteSuccess(resp, http.StatusOK, keys)
+}
+
+// 吊销个人 API key
+func (h *APIKeyHandler) RevokeAPIKeyHandler(req *restful.Request, resp *restful.Response) {
+	keyID := req.PathParameter("keyId")
+	if err := h.apiKeys.RevokeAPIKey(auth.GetUserID(req), keyID); err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	response.WriteSuccess(resp, http.StatusOK, keyID)
+}
+
+// APIKeyProjectFilter 限定项目的 API key 只能访问这些项目及其下的会话，需挂在 AuthFilter 之后
+// 没有 projectId / sessionId 路径参数的接口（如列表、新建会话）无法确定项目，一律拒绝
+func (h *APIKeyHandler) APIKeyProjectFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	token := auth.GetAuthContext(req)
+	if token == nil || !token.IsAPIKey() || len(token.Projects()) == 0 {
+		chain.ProcessFilter(req, resp)
+		return
+	}
+
+	projectID := req.PathParameter("projectId")
+	if projectID == "" {
+		if sessionID := req.PathParameter("sessionId"); sessionID != "" {
+			id, err := h.sessions.SessionProjectID(auth.GetUserID(req), sessionID)
+			if err != nil {
+				response.WriteBizError(resp, err)
+				return
+			}
+			projectID = id
+		}
+	}
+	if projectID == "" || !token.CanAccessProject(projectID) {
+		response.WriteBizError(resp, constant.ErrForbidden)
+		return
+	}
+
+	chain.ProcessFilter(req, resp)
+}
@@ -13,8 +13,21 @@ import (
 	"github.com/emicklei/go-restful/v3"
 )
 
+// MessageHandler 消息与对话接口
+type MessageHandler struct {
+	sessions *service.SessionService
+	messages *service.MessageService
+	chat     *service.ChatService
+	streams  *service.StreamManager
+}
+
+// 创建消息与对话接口
+func NewMessageHandler(sessions *service.SessionService, messages *service.MessageService, chat *service.ChatService, streams *service.StreamManager) *MessageHandler {
+	return &MessageHandler{sessions: sessions, messages: messages, chat: chat, streams: streams}
+}
+
 // NewChatHandler 在已有会话中创建新对话
-func NewChatHandler(req *restful.Request, resp *restful.Response) {
+func (h *MessageHandler) NewChatHandler(req *restful.Request, resp *restful.Response) {
 
 	reqBody, err := service.BindRequestBody[requests.StreamChatReq](req)
 	if err != nil {
@@ -38,7 +51,7 @@ func NewChatHandler(req *restful.Request, resp *restful.Response) {
 	}
 	log.Printf("NewChatHandler request: sessionId=%s, DTO=%+v", sessionID, streamChatDto)
 
-	if err := service.NewStreamChatInSession(streamChatDto); err != nil {
+	if err := h.chat.NewStreamChatInSession(streamChatDto); err != nil {
 		response.WriteBizError(resp, err)
 		return
 	}
@@ -47,7 +60,7 @@ func NewChatHandler(req *restful.Request, resp *restful.Response) {
 }
 
 // ResumeStreamChatHandler 续传对话
-func ResumeStreamChatHandler(req *restful.Request, resp *restful.Response) {
+func (h *MessageHandler) ResumeStreamChatHandler(req *restful.Request, resp *restful.Response) {
 	//解析请求体
 	reqBody, err := service.BindRequestBody[requests.ResumeStreamChatReq](req)
 	if err != nil {
@@ -62,7 +75,7 @@ func ResumeStreamChatHandler(req *restful.Request, resp *restful.Response) {
 	log.Printf("Resume request: sessionId=%s, body=%+v", sessionID, reqBody)
 
 	//调用服务层
-	err = service.ResumeStreamChat(userId, sessionID, reqBody, req, resp)
+	err = h.chat.ResumeStreamChat(userId, sessionID, reqBody, req, resp)
 	if err != nil {
 		log.Println("ResumeStreamChatHandler error:", err)
 		response.WriteBizError(resp, err)
@@ -72,8 +85,65 @@ func ResumeStreamChatHandler(req *restful.Request, resp *restful.Response) {
 	// response.WriteSuccess(resp, http.StatusOK, nil)
 }
 
+// RegenerateStreamChatHandler 重新生成某条回答，sse流式响应
+func (h *MessageHandler) RegenerateStreamChatHandler(req *restful.Request, resp *restful.Response) {
+	sessionID := req.PathParameter("sessionId")
+	messageID := req.PathParameter("messageId")
+	if messageID == "" {
+		response.WriteBizError(resp, constant.ErrInvalidMessageID)
+		return
+	}
+	userId := auth.GetUserID(req)
+	log.Printf("Regenerate request: sessionId=%s, messageId=%s", sessionID, messageID)
+
+	//调用服务层
+	if err := h.chat.RegenerateStreamChat(userId, sessionID, messageID, req, resp); err != nil {
+		log.Println("RegenerateStreamChatHandler error:", err)
+		response.WriteBizError(resp, err)
+		return
+	}
+}
+
+// EditAndResendStreamChatHandler 编辑用户消息并重发，sse流式响应
+func (h *MessageHandler) EditAndResendStreamChatHandler(req *restful.Request, resp *restful.Response) {
+	//解析请求体
+	reqBody, err := service.BindRequestBody[requests.EditMessageReq](req)
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	sessionID := req.PathParameter("sessionId")
+	messageID := req.PathParameter("messageId")
+	if messageID == "" {
+		response.WriteBizError(resp, constant.ErrInvalidMessageID)
+		return
+	}
+	userId := auth.GetUserID(req)
+	log.Printf("Edit request: sessionId=%s, messageId=%s, body=%+v", sessionID, messageID, reqBody)
+
+	//调用服务层
+	if err := h.chat.EditAndResendStreamChat(userId, sessionID, messageID, reqBody, req, resp); err != nil {
+		log.Println("EditAndResendStreamChatHandler error:", err)
+		response.WriteBizError(resp, err)
+		return
+	}
+}
+
+// SessionWebSocketHandler 会话的 WebSocket 连接，复用发送、续传、中断和重新生成
+func (h *MessageHandler) SessionWebSocketHandler(req *restful.Request, resp *restful.Response) {
+	userId := auth.GetUserID(req)
+	sessionID := req.PathParameter("sessionId")
+
+	// 升级前的校验失败以普通 HTTP 响应返回
+	if err := h.chat.ServeSessionWebSocket(userId, sessionID, req, resp); err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+}
+
 // BreakStreamChatHandler 中断流
-func BreakStreamChatHandler(req *restful.Request, resp *restful.Response) {
+func (h *MessageHandler) BreakStreamChatHandler(req *restful.Request, resp *restful.Response) {
 
 	// 1. 解析参数
 	reqBody, err := service.BindRequestBody[requests.BreakStreamChatReq](req)
@@ -87,13 +157,13 @@ func BreakStreamChatHandler(req *restful.Request, resp *restful.Response) {
 	//验证会话归属
 	sessionID := req.PathParameter("sessionId")
 	userId := auth.GetUserID(req)
-	if _, err := service.QuerySession(userId, sessionID); err != nil {
+	if _, err := h.sessions.QuerySession(userId, sessionID); err != nil {
 		response.WriteBizError(resp, err)
 		return
 	}
 
 	// 中断流
-	exists, err := service.GlobalStreamManager.BreakStream(sessionID, reqBody.MessageID)
+	exists, err := h.streams.BreakStream(sessionID, reqBody.MessageID)
 	if !exists {
 		response.WriteBizError(resp, constant.ErrStreamNotFound)
 		return
@@ -106,7 +176,7 @@ func BreakStreamChatHandler(req *restful.Request, resp *restful.Response) {
 	response.WriteSuccess(resp, http.StatusOK, nil)
 }
 
-func DeleteMessageHandler(req *restful.Request, resp *restful.Response) {
+func (h *MessageHandler) DeleteMessageHandler(req *restful.Request, resp *restful.Response) {
 	// 1. 解析参数
 	messageID := req.PathParameter("messageId")
 	// 2. 统一处理解析错误 (Handler 负责 HTTP 响应)
@@ -118,13 +188,13 @@ func DeleteMessageHandler(req *restful.Request, resp *restful.Response) {
 	//验证会话归属
 	sessionID := req.PathParameter("sessionId")
 	userId := auth.GetUserID(req)
-	if _, err := service.QuerySession(userId, sessionID); err != nil {
+	if _, err := h.sessions.QuerySession(userId, sessionID); err != nil {
 		response.WriteBizError(resp, err)
 		return
 	}
 
 	//删除消息
-	if err := service.DeleteMessage(sessionID, messageID); err != nil {
+	if err := h.messages.DeleteMessage(sessionID, messageID); err != nil {
 		log.Println("DeleteMessageHandler error:", err)
 		response.WriteBizError(resp, err)
 		return
@@ -11,8 +11,19 @@ import (
 	"github.com/emicklei/go-restful/v3"
 )
 
+// ProjectHandler 项目接口
+type ProjectHandler struct {
+	projects *service.ProjectService
+	sessions *service.SessionService
+}
+
+// 创建项目接口
+func NewProjectHandler(projects *service.ProjectService, sessions *service.SessionService) *ProjectHandler {
+	return &ProjectHandler{projects: projects, sessions: sessions}
+}
+
 // 创建一个项目，指定标题
-func CreateProjectHandler(req *restful.Request, resp *restful.Response) {
+func (h *ProjectHandler) CreateProjectHandler(req *restful.Request, resp *restful.Response) {
 	// 1. 解析参数
 	reqBody, err := service.BindRequestBody[requests.CreateAndUpdateProjectReq](req)
 	// 2. 统一处理解析错误 (Handler 负责 HTTP 响应)
@@ -22,7 +33,7 @@ func CreateProjectHandler(req *restful.Request, resp *restful.Response) {
 	}
 
 	// 调用服务层
-	project, err := service.CreateProject(reqBody, auth.GetUserID(req))
+	project, err := h.projects.CreateProject(reqBody, auth.GetUserID(req))
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
@@ -32,7 +43,7 @@ func CreateProjectHandler(req *restful.Request, resp *restful.Response) {
 }
 
 // 更新项目
-func UpdateProjectHandler(req *restful.Request, resp *restful.Response) {
+func (h *ProjectHandler) UpdateProjectHandler(req *restful.Request, resp *restful.Response) {
 	// 1. 解析参数
 	reqBody, err := service.BindRequestBody[requests.CreateAndUpdateProjectReq](req)
 	// 2. 统一处理解析错误 (Handler 负责 HTTP 响应)
@@ -45,7 +56,7 @@ func UpdateProjectHandler(req *restful.Request, resp *restful.Response) {
 	userID := auth.GetUserID(req)
 
 	// 调用服务层
-	if _, err := service.UpdateProject(reqBody, projectID, userID); err != nil {
+	if _, err := h.projects.UpdateProject(reqBody, projectID, userID); err != nil {
 		response.WriteBizError(resp, err)
 		return
 	}
@@ -54,12 +65,12 @@ func UpdateProjectHandler(req *restful.Request, resp *restful.Response) {
 }
 
 // 删除一个项目
-func DeleteProjectHandler(req *restful.Request, resp *restful.Response) {
+func (h *ProjectHandler) DeleteProjectHandler(req *restful.Request, resp *restful.Response) {
 	projectID := req.PathParameter("projectId")
 	userID := auth.GetUserID(req)
 
 	// 调用服务层
-	if err := service.DeleteProject(projectID, userID); err != nil {
+	if err := h.projects.DeleteProject(projectID, userID); err != nil {
 		response.WriteBizError(resp, err)
 		return
 	}
@@ -67,12 +78,12 @@ func DeleteProjectHandler(req *restful.Request, resp *restful.Response) {
 }
 
 // 查询所有项目
-func ListProjectsHandler(req *restful.Request, resp *restful.Response) {
+func (h *ProjectHandler) ListProjectsHandler(req *restful.Request, resp *restful.Response) {
 	// 从请求头中获取用户ID
 	userID := auth.GetUserID(req)
 
 	// 调用服务层
-	projects, err := service.ListProjects(userID)
+	projects, err := h.projects.ListProjects(userID)
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
@@ -83,14 +94,14 @@ func ListProjectsHandler(req *restful.Request, resp *restful.Response) {
 }
 
 // 查询某个项目下的所有会话
-func ListProjectSessionsHandler(req *restful.Request, resp *restful.Response) {
+func (h *ProjectHandler) ListProjectSessionsHandler(req *restful.Request, resp *restful.Response) {
 
 	// 从请求头中获取用户ID
 	userID := auth.GetUserID(req)
 	projectID := req.PathParameter("projectId")
 
 	// 调用服务层
-	sessions, err := service.ListSessionsInProject(userID, projectID)
+	sessions, err := h.sessions.ListSessionsInProject(userID, projectID)
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
@@ -99,3 +110,19 @@ func ListProjectSessionsHandler(req *restful.Request, resp *restful.Response) {
 	// 构造响应
 	response.WriteSuccess(resp, http.StatusOK, sessions)
 }
+
+// 查询某个项目的token用量
+func (h *ProjectHandler) GetProjectUsageHandler(req *restful.Request, resp *restful.Response) {
+
+	userID := auth.GetUserID(req)
+	projectID := req.PathParameter("projectId")
+
+	// 调用服务层
+	usage, err := h.projects.GetProjectTokenUsage(userID, projectID)
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	response.WriteSuccess(resp, http.StatusOK, usage)
+}
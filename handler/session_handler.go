@@ -3,16 +3,30 @@ package handler
 import (
 	"log"
 	"net/http"
+	constant "session-management/const"
 	"session-management/pkg/auth"
 	"session-management/requests"
 	"session-management/response"
 	"session-management/service"
+	"strconv"
 
 	"github.com/emicklei/go-restful/v3"
 )
 
+// SessionHandler 会话接口
+type SessionHandler struct {
+	sessions *service.SessionService
+	messages *service.MessageService
+	chat     *service.ChatService
+}
+
+// 创建会话接口
+func NewSessionHandler(sessions *service.SessionService, messages *service.MessageService, chat *service.ChatService) *SessionHandler {
+	return &SessionHandler{sessions: sessions, messages: messages, chat: chat}
+}
+
 // 创建一个会话并对话，sse流式响应CreateSessioAndChatHandler
-func CreateSessioAndChatHandler(req *restful.Request, resp *restful.Response) {
+func (h *SessionHandler) CreateSessioAndChatHandler(req *restful.Request, resp *restful.Response) {
 	// 1. 解析参数
 	reqData, err := service.BindRequestBody[requests.CreateSessionAndChatReq](req)
 	if err != nil {
@@ -22,7 +36,7 @@ func CreateSessioAndChatHandler(req *restful.Request, resp *restful.Response) {
 	userID := auth.GetUserID(req)
 
 	//服务层
-	if err := service.CreateSessionAndChat(userID, reqData, req, resp); err != nil {
+	if err := h.chat.CreateSessionAndChat(userID, reqData, req, resp); err != nil {
 		response.WriteBizError(resp, err)
 		return
 	}
@@ -67,35 +81,87 @@ func CreateSessioAndChatHandler(req *restful.Request, resp *restful.Response) {
 
 }
 
-// 查询某个会话的所有消息
-func ListMessagesBySessionHandler(req *restful.Request, resp *restful.Response) {
+// 查询某个会话激活分支上的消息
+func (h *SessionHandler) ListMessagesBySessionHandler(req *restful.Request, resp *restful.Response) {
 
 	userID := auth.GetUserID(req)
 	sessionID := req.PathParameter("sessionId")
 	// 调用服务层
-	messages, err := service.ListMessagesBySession(userID, sessionID)
+	listMessagesResponse, err := h.messages.GetConversationView(userID, sessionID)
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
 	}
 
-	currentMsgId := ""
-	if len(messages) > 0 {
-		currentMsgId = messages[len(messages)-1].ID
+	response.WriteSuccess(resp, http.StatusOK, listMessagesResponse)
+}
+
+// SwitchActiveBranchHandler 切换会话的激活分支
+func (h *SessionHandler) SwitchActiveBranchHandler(req *restful.Request, resp *restful.Response) {
+	reqData, err := service.BindRequestBody[requests.SwitchBranchReq](req)
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
 	}
-	listMessagesResponse := response.ListMessagesResponse{
-		Messages:         messages,
-		CurrentMessageId: currentMsgId,
+
+	userID := auth.GetUserID(req)
+	sessionID := req.PathParameter("sessionId")
+
+	// 调用服务层
+	listMessagesResponse, err := h.messages.SwitchActiveBranch(userID, sessionID, reqData.MessageID)
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
 	}
 
 	response.WriteSuccess(resp, http.StatusOK, listMessagesResponse)
 }
 
-func ListSessionsNotInProjectHandler(req *restful.Request, resp *restful.Response) {
+// GetMessageTreeHandler 查询会话的消息树
+func (h *SessionHandler) GetMessageTreeHandler(req *restful.Request, resp *restful.Response) {
+
+	userID := auth.GetUserID(req)
+	sessionID := req.PathParameter("sessionId")
+
+	opts := service.MessageTreeOptions{RootID: req.QueryParameter("root_id")}
+	var err error
+	if opts.MaxDepth, err = intQueryParameter(req, "max_depth"); err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+	if opts.ContentLimit, err = intQueryParameter(req, "content_limit"); err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	// 调用服务层
+	tree, err := h.messages.GetMessageTree(userID, sessionID, opts)
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	response.WriteSuccess(resp, http.StatusOK, tree)
+}
+
+// intQueryParameter 解析整数查询参数，缺省为0
+func intQueryParameter(req *restful.Request, name string) (int, error) {
+	raw := req.QueryParameter(name)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0, constant.BuildBizError(http.StatusBadRequest, 400, "参数"+name+"必须是非负整数")
+	}
+	return v, nil
+}
+
+func (h *SessionHandler) ListSessionsNotInProjectHandler(req *restful.Request, resp *restful.Response) {
 
 	userID := auth.GetUserID(req)
 	// 调用服务层
-	sessions, err := service.ListSessionsNotInProject(userID)
+	sessions, err := h.sessions.ListSessionsNotInProject(userID)
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
@@ -105,19 +171,25 @@ func ListSessionsNotInProjectHandler(req *restful.Request, resp *restful.Respons
 }
 
 // / MoveSessionToProjectHandler 移动一个会话到某个指定项目
-func MoveSessionToProjectHandler(req *restful.Request, resp *restful.Response) {
+func (h *SessionHandler) MoveSessionToProjectHandler(req *restful.Request, resp *restful.Response) {
 	reqData, err := service.BindRequestBody[requests.MoveSessionToProjectReq](req)
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
 	}
 
+	// 限定项目的 API key 只能把会话移到这些项目中，原会话所在项目由 APIKeyProjectFilter 检查
+	if token := auth.GetAuthContext(req); token != nil && !token.CanAccessProject(reqData.ProjectID) {
+		response.WriteBizError(resp, constant.ErrForbidden)
+		return
+	}
+
 	// 从请求头中获取用户ID
 	userID := auth.GetUserID(req)
 	sessionID := req.PathParameter("sessionId")
 
 	// 调用服务层
-	err = service.MoveSessionToProject(userID, sessionID, reqData.ProjectID)
+	err = h.sessions.MoveSessionToProject(userID, sessionID, reqData.ProjectID)
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
@@ -128,7 +200,7 @@ func MoveSessionToProjectHandler(req *restful.Request, resp *restful.Response) {
 }
 
 // 更新session配置
-func UpdateSessionHandler(req *restful.Request, resp *restful.Response) {
+func (h *SessionHandler) UpdateSessionHandler(req *restful.Request, resp *restful.Response) {
 
 	// 从请求头中获取用户ID
 	userID := auth.GetUserID(req)
@@ -141,7 +213,7 @@ func UpdateSessionHandler(req *restful.Request, resp *restful.Response) {
 	}
 
 	// 调用服务层
-	err = service.UpdateSession(userID, sessionID, reqData.Title)
+	err = h.sessions.UpdateSession(userID, sessionID, reqData.Title)
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
@@ -150,11 +222,11 @@ func UpdateSessionHandler(req *restful.Request, resp *restful.Response) {
 	response.WriteSuccess(resp, http.StatusOK, nil)
 
 }
-func ListAllSessionsHandler(req *restful.Request, resp *restful.Response) {
+func (h *SessionHandler) ListAllSessionsHandler(req *restful.Request, resp *restful.Response) {
 
 	userID := auth.GetUserID(req)
 	// 调用服务层
-	sessions, err := service.ListAllSessions(userID)
+	sessions, err := h.sessions.ListAllSessions(userID)
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
@@ -163,13 +235,13 @@ func ListAllSessionsHandler(req *restful.Request, resp *restful.Response) {
 	response.WriteSuccess(resp, http.StatusOK, sessions)
 }
 
-func DeleteSessionHandler(req *restful.Request, resp *restful.Response) {
+func (h *SessionHandler) DeleteSessionHandler(req *restful.Request, resp *restful.Response) {
 
 	userID := auth.GetUserID(req)
 	sessionID := req.PathParameter("sessionId")
 
 	// 调用服务层,并删除会话中的所有消息，不删也没关系，访问不到了TODO:
-	err := service.DeleteSession(userID, sessionID)
+	err := h.sessions.DeleteSession(userID, sessionID)
 	if err != nil {
 		response.WriteBizError(resp, err)
 		return
@@ -178,3 +250,33 @@ func DeleteSessionHandler(req *restful.Request, resp *restful.Response) {
 
 	response.WriteSuccess(resp, http.StatusOK, nil)
 }
+
+// GetSessionUsageHandler 查询会话的token用量
+func (h *SessionHandler) GetSessionUsageHandler(req *restful.Request, resp *restful.Response) {
+
+	userID := auth.GetUserID(req)
+	sessionID := req.PathParameter("sessionId")
+	// 调用服务层
+	usage, err := h.sessions.GetSessionTokenUsage(userID, sessionID)
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	response.WriteSuccess(resp, http.StatusOK, usage)
+}
+
+// ListSessionStreamsHandler 查询会话正在进行的流式生成
+func (h *SessionHandler) ListSessionStreamsHandler(req *restful.Request, resp *restful.Response) {
+
+	userID := auth.GetUserID(req)
+	sessionID := req.PathParameter("sessionId")
+	// 调用服务层
+	streams, err := h.chat.ListSessionStreams(userID, sessionID)
+	if err != nil {
+		response.WriteBizError(resp, err)
+		return
+	}
+
+	response.WriteSuccess(resp, http.StatusOK, streams)
+}
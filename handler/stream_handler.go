@@ -265,40 +265,3 @@ package handler
 // // 	// 更新会话时间
 // // 	my_service.My_dbservice.DB.Model(&my_models.Session{ID: req.SessionID}).Update("updated_at", time.Now())
 // // }
-
-// // 查询流状态接口
-// func handleStreamStatus(c *gin.Context) {
-// 	sessionID := c.Query("session_id")
-
-// 	if sessionID == "" {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": "需要session_id或message_id"})
-// 		return
-// 	}
-
-// 	streamManager.Mu.RLock()
-// 	defer streamManager.Mu.RUnlock()
-
-// 	var result []gin.H
-
-// 	for _, stream := range streamManager.Streams {
-// 		if sessionID != "" && stream.SessionID == sessionID {
-// 			result = append(result, gin.H{
-// 				"message_id":   stream.MessageID,
-// 				"session_id":   stream.SessionID,
-// 				"query":        stream.Query,
-// 				"is_completed": stream.IsCompleted,
-// 				"total_chunks": len(stream.Chunks),
-// 				"created_at":   stream.CreatedAt,
-// 				"updated_at":   stream.UpdatedAt,
-// 				"client_count": len(stream.Clients),
-// 			})
-// 			break
-// 		}
-// 	}
-
-// 	c.JSON(http.StatusOK, gin.H{
-// 		"success": true,
-// 		"count":   len(result),
-// 		"streams": result,
-// 	})
-// }
@@ -1,15 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
-	"reflect"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"session-management/pkg/auth"
-	"session-management/requests"
-
-	"session-management/handler"
-	"session-management/response"
+	"session-management/config"
 
 	"github.com/emicklei/go-restful/v3"
 )
@@ -439,155 +439,46 @@ import (
 // }
 
 func main() {
+	// 加载配置：config.yaml < 环境变量 < 命令行参数
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("加载配置失败: ", err)
+	}
+	// 构造认证、数据库、服务和接口
+	app, err := NewContainer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// 修复 */* 问题
 	// restful.RegisterEntityAccessor("*/*", &restful.JsonEntityReader{})
 
-	ws := new(restful.WebService)
-	ws.Filter(auth.AuthFilter)
-	ws.
-		Path("/api/v1/applet/ai").
-		Consumes(restful.MIME_JSON, restful.MIME_XML).
-		Produces(restful.MIME_JSON, restful.MIME_XML)
-
-	// 路径参数模板（安全复用：restful 内部会复制参数）
-	projectIdParam := ws.PathParameter("projectId", "Project ID").DataType("string").Required(true)
-	sessionIdParam := ws.PathParameter("sessionId", "Session ID").DataType("string").Required(true)
-
-	//项目
-	//创建一个项目，指定标题（可选）
-	ws.Route(ws.POST("/projects").To(handler.CreateProjectHandler).
-		Doc("Create a new project").
-		Param(ws.BodyParameter("request", "CreateAndUpdateProjectReq").
-			DataType(reflect.TypeFor[requests.CreateAndUpdateProjectReq]().String()).Required(true)).
-		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
-
-	//更新项目
-	ws.Route(ws.PATCH("/projects/{projectId}").To(handler.UpdateProjectHandler).
-		Doc("Update a project title").
-		Param(projectIdParam).
-		Param(ws.BodyParameter("request", "CreateAndUpdateProjectReq").DataType(reflect.TypeFor[requests.CreateAndUpdateProjectReq]().String())).
-		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
-
-	//查询所有项目
-	ws.Route(ws.GET("/projects").To(handler.ListProjectsHandler).
-		Doc("List all projects").
-		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
-
-	//删除一个项目
-	ws.Route(ws.DELETE("/projects/{projectId}").To(handler.DeleteProjectHandler).
-		Doc("Delete a project").
-		Param(projectIdParam).
-		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
-
-	// 查询某个项目下的所有会话
-	ws.Route(ws.GET("/projects/{projectId}/sessions").To(handler.ListProjectSessionsHandler).
-		Doc("List all sessions under a project").
-		Param(projectIdParam).
-		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
-
-	//会话
-	// 查询所有会话
-	ws.Route(ws.GET("/sessions").To(handler.ListAllSessionsHandler).
-		Doc("List all sessions").
-		Returns(200, "OK", response.CommonResponse{}).
-		Returns(401, "Unauthorized", nil).
-		Returns(403, "Forbidden", nil).
-		Returns(404, "Not Found", nil))
-	//删除一个会话
-	ws.Route(ws.DELETE("/sessions/{sessionId}").To(handler.DeleteSessionHandler).
-		Doc("Delete a session").
-		Param(sessionIdParam).
-		Returns(200, "OK", response.CommonResponse{}).
-		Returns(204, "No Content", nil).
-		Returns(400, "Bad Request", nil))
-
-	//修改会话标题
-	ws.Route(ws.PATCH("/sessions/{sessionId}").To(handler.UpdateSessionHandler).
-		Doc("Update a session title").
-		Param(sessionIdParam).
-		Param(ws.BodyParameter("request", "UpdateSessionReq").DataType("requests.UpdateSessionReq")).
-		Returns(200, "OK", response.CommonResponse{}).
-		Returns(400, "Bad Request", nil))
-
-	//查询某个会话所有消息
-	ws.Route(ws.GET("/sessions/{sessionId}/messages").To(handler.ListMessagesBySessionHandler).
-		Doc("Get session history").
-		Param(sessionIdParam).
-		Returns(200, "OK", response.ListMessagesResponse{}).
-		Returns(400, "Bad Request", nil))
-
-	// 获取不在项目里的会话
-	ws.Route(ws.GET("/sessions/unassigned").To(handler.ListSessionsNotInProjectHandler).
-		Doc("List all sessions not in project").
-		Returns(200, "OK", response.ListSessionsResponse{}).
-		Returns(400, "Bad Request", nil))
-
-	//移动一个会话到某个指定项目
-	ws.Route(ws.PUT("/sessions/{sessionId}/move").To(handler.MoveSessionToProjectHandler).
-		Doc("Move a session to a project").
-		Param(sessionIdParam).
-		Param(ws.BodyParameter("request", "MoveSessionToProjectReq").DataType("requests.MoveSessionToProjectReq")).
-		Returns(200, "OK", response.MoveSessionToProjectResponse{}).
-		Returns(400, "Bad Request", nil))
-
-	//中断接口
-	ws.Route(ws.POST("/sessions/{sessionId}/stream/break").
-		To(handler.BreakStreamChatHandler).
-		Doc("Break session chat ").
-		Param(sessionIdParam).
-		Param(ws.BodyParameter("request", "BreakStreamChatReq").
-			DataType("requests.BreakStreamChatReq")).
-		Returns(200, "OK", response.BreakStreamChatResponse{}))
-
-	//消息
-	//删除一条消息以及后续消息
-	ws.Route(ws.DELETE("/sessions/{sessionId}/messages/{messageId}").To(handler.DeleteMessageHandler).
-		Doc("Delete a message").
-		Param(ws.PathParameter("messageId", "Message ID").DataType("string").Required(true)).
-		Param(sessionIdParam).
-		Returns(200, "OK", nil).
-		Returns(204, "No Content", nil).
-		Returns(400, "Bad Request", nil))
-
-	//============================================流式接口================================
-	//创建一个会话并对话，sse流式响应
-	ws.Route(ws.POST("/sessions/stream").
-		Consumes(restful.MIME_JSON).
-		// Produces("text/event-stream").
-		To(handler.CreateSessioAndChatHandler).
-		Doc("Create session and chat (SSE)").
-		Param(ws.BodyParameter("request", "CreateSessionAndChatReq").
-			DataType(reflect.TypeFor[requests.CreateSessionAndChatReq]().String())).
-		Returns(200, "OK", nil))
-
-	//在已有会话中对话
-	ws.Route(ws.POST("/sessions/{sessionId}/stream").
-		Consumes(restful.MIME_JSON).
-		// Produces("text/event-stream").
-		To(handler.NewChatHandler).
-		Doc("Chat in a session (SSE)").
-		Param(sessionIdParam).
-		Reads(requests.StreamChatReq{}).
-		// Param(ws.BodyParameter("request", "StreamChatReq").
-		// 	DataType("requests.StreamChatReq")).
-		Returns(200, "OK", nil))
-
-	//resume接口
-	ws.Route(ws.POST("/sessions/{sessionId}/stream/resume").
-		To(handler.ResumeStreamChatHandler).
-		Doc("Resume session chat (SSE)").
-		Consumes(restful.MIME_JSON).
-		// Produces("text/event-stream").
-		Param(ws.PathParameter("sessionId", "Session ID").DataType("string").Required(true)).
-		Param(ws.BodyParameter("request", "ResumeStreamChatReq").
-			// DataType("my_requests.ResumeStreamChatReq")).
-			DataType("requests.ResumeStreamChatReq")).
-		Returns(200, "OK", nil))
-
-	restful.Add(ws)
+	restful.Add(NewWebService(app))
 	restful.EnableTracing(true)
-	log.Fatal(http.ListenAndServe(":8080", nil)) // 推荐使用 log.Fatal 捕获启动错误
+
+	// 上次进程遗留的生成中消息标记为中断
+	app.Streams.RecoverOrphanedStreams()
+	// 监听其它实例转发的中断请求
+	if err := app.Streams.StartStreamBus(context.Background()); err != nil {
+		log.Printf("StartStreamBus failed: %v", err)
+	}
+	// 定期清理：中断空闲的生成，移除过期的已结束流
+	app.Streams.StartStreamJanitor(context.Background())
+
+	srv := &http.Server{Addr: cfg.Server.Addr, ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err) // 推荐使用 log.Fatal 捕获启动错误
+		}
+	}()
+
+	// 收到 SIGINT/SIGTERM 后优雅停止：拒绝新对话，等待生成结束，超时的按中断入库
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("shutting down...")
+	app.Streams.Shutdown(srv, cfg.Server.ShutdownTimeout)
+	log.Println("server stopped")
 
 	// 创建Gin引擎
 	// r := gin.Default()
@@ -69,6 +69,8 @@ type Session struct {
 	Archived  bool      `gorm:"not null;default:false" json:"archived"`     // 是否归档
 	ShareLink *string   `gorm:"type:varchar(255)" json:"share_link"`        //
 	Extension JSONMap   `gorm:"type:json;serializer:json" json:"extension"` // 扩展字段（存 JSON 字符串）
+
+	ActiveLeafID *string `gorm:"type:char(36)" json:"active_leaf_id"` // 当前激活分支的叶子消息ID
 }
 
 // Message 消息表
@@ -83,12 +85,40 @@ type Message struct {
 	Steps StepList `gorm:"type:json;serializer:json" json:"steps"` // ← 关键：用自定义类型 + json
 	Files FileList `gorm:"type:json;serializer:json" json:"files"` // 建议用 json 而非 text（PostgreSQL）或 longtext（MySQL）
 
-	TokenCount int       `gorm:"default:0"` // 建议添加：消息token数统计
-	CreatedAt  time.Time `gorm:"not null" json:"created_at"`
-	UpdatedAt  time.Time `gorm:"not null" json:"updated_at"`
-	Deleted    bool      `gorm:"not null;default:false" json:"deleted"`      //是否删除
-	Extension  JSONMap   `gorm:"type:json;serializer:json" json:"extension"` // 扩展字段（存 JSON 字符串）
-	Metadata   JSONMap   `gorm:"type:json;serializer:json" json:"metadata"`  //其他信息
+	TokenCount       int       `gorm:"default:0"`                          // 消息内容的token数
+	PromptTokens     int       `gorm:"default:0" json:"prompt_tokens"`     // 生成该消息时输入的token数，仅助手消息
+	CompletionTokens int       `gorm:"default:0" json:"completion_tokens"` // 生成该消息输出的token数，仅助手消息
+	CreatedAt        time.Time `gorm:"not null" json:"created_at"`
+	UpdatedAt        time.Time `gorm:"not null" json:"updated_at"`
+	Deleted          bool      `gorm:"not null;default:false" json:"deleted"`      //是否删除
+	Extension        JSONMap   `gorm:"type:json;serializer:json" json:"extension"` // 扩展字段（存 JSON 字符串）
+	Metadata         JSONMap   `gorm:"type:json;serializer:json" json:"metadata"`  //其他信息
+}
+
+// StreamChunkLog 流式生成的chunk日志，服务重启后用于续传和恢复
+type StreamChunkLog struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	SessionID string    `gorm:"type:varchar(64);not null;index:idx_stream_chunk,priority:1" json:"session_id"`
+	MessageID string    `gorm:"type:char(36);not null;index:idx_stream_chunk,priority:2" json:"message_id"`
+	ChunkID   int       `gorm:"not null;index:idx_stream_chunk,priority:3" json:"chunk_id"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+}
+
+// APIKey 个人 API key，只保存哈希，明文只在签发时返回一次
+type APIKey struct {
+	ID         string     `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID     string     `gorm:"type:varchar(64);not null;index" json:"user_id"`
+	Name       string     `gorm:"type:varchar(255);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"`      // 明文的前几位，便于用户辨认
+	KeyHash    string     `gorm:"type:char(64);not null;uniqueIndex" json:"-"`  // 明文的 sha256
+	Scope      string     `gorm:"type:varchar(16);not null" json:"scope"`       // read / write
+	ProjectIDs []string   `gorm:"type:json;serializer:json" json:"project_ids"` // 限定的项目，为空表示不限
+	Roles      []string   `gorm:"type:json;serializer:json" json:"roles"`       // 签发时用户拥有的角色，之后不随用户角色变化
+	ExpiresAt  *time.Time `json:"expires_at"`                                   // 为空表示不过期
+	LastUsedAt *time.Time `json:"last_used_at"`                                 // 最近一次使用时间
+	RevokedAt  *time.Time `json:"revoked_at"`                                   // 吊销时间
+	CreatedAt  time.Time  `gorm:"not null" json:"created_at"`
 }
 
 // StepNode 步骤节点，表示助手的思考、工具调用等
@@ -250,3 +280,11 @@ func (Message) TableName() string {
 func (Project) TableName() string {
 	return "my_test_projects"
 }
+
+func (StreamChunkLog) TableName() string {
+	return "my_test_stream_chunks"
+}
+
+func (APIKey) TableName() string {
+	return "my_test_api_keys"
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	response "session-management/response"
+	"strings"
 	"time"
 
 	"github.com/emicklei/go-restful/v3"
@@ -40,6 +41,8 @@ type JWToken struct {
 	issuedAt  int64
 	iss       string
 	sub       string
+	apiKey    bool     // 通过个人 API key 认证
+	projects  []string // API key 限定的项目，为空表示不限
 }
 
 var defaultToken = &JWToken{
@@ -52,36 +55,76 @@ var defaultToken = &JWToken{
 	sub:       DefaultSub,
 }
 
-// 从请求头中获取用户ID
-func getUserIdFromHeader(req *restful.Request) string {
-	// 示例：从请求头中获取用户ID（假设有认证中间件设置）
-	token := req.HeaderParameter("TOKEN")
-	req.SetAttribute("user_id", token)
-	log.Println("extracted user_id from header:", token)
+// tokenFromHeader 从请求头中获取 token，优先 Authorization: Bearer，兼容 TOKEN 头
+func tokenFromHeader(req *restful.Request) string {
+	if h := req.HeaderParameter("Authorization"); h != "" {
+		if token, ok := strings.CutPrefix(h, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return req.HeaderParameter("TOKEN")
+}
 
-	v := req.Attribute("user_id")
-	userID, ok := v.(string)
-	if !ok || userID == "" {
-		log.Println("user_id is missing or invalid, userID=", userID)
-		return ""
+// Authenticator 认证与授权：JWT 验证密钥、角色矩阵和 API key 校验，过滤器由它构造
+type Authenticator struct {
+	keys     *KeySet
+	matrix   RoleMatrix
+	resolver APIKeyResolver
+}
+
+// NewAuthenticator 创建认证器，keys 为空时所有 JWT 都会被拒绝，resolver 为 nil 时所有 API key 都会被拒绝
+func NewAuthenticator(keys *KeySet, matrix RoleMatrix, resolver APIKeyResolver) *Authenticator {
+	if matrix == nil {
+		matrix = DefaultRoleMatrix()
 	}
-	return userID
+	return &Authenticator{keys: keys, matrix: matrix, resolver: resolver}
+}
+
+// parseAPIKey 交给业务层的校验函数验证 API key
+func (a *Authenticator) parseAPIKey(key string) (*JWToken, error) {
+	if a.resolver == nil {
+		return nil, ErrAPIKeyDisabled
+	}
+	return a.resolver(key)
 }
 
 // AuthFilter 拦截所有需要认证的请求
-func AuthFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
-	userID := getUserIdFromHeader(req) // 修改 GetUserIdFromHeader 不要传入 resp，只返回 string
-	if userID == "" {
+// 验证 JWT 或个人 API key 后把用户信息存入请求上下文，token 缺失、过期或被篡改时返回 401
+func (a *Authenticator) AuthFilter(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	raw := tokenFromHeader(req)
+	var (
+		token *JWToken
+		err   error
+	)
+	if strings.HasPrefix(raw, APIKeyPrefix) {
+		token, err = a.parseAPIKey(raw)
+	} else {
+		token, err = a.ParseToken(raw)
+	}
+	if err != nil {
+		log.Printf("auth failed: %s %s: %v", req.Request.Method, req.Request.URL.Path, err)
 		resp.WriteHeaderAndEntity(http.StatusUnauthorized, response.CommonResponse{
 			Code:    401,
 			Message: "Unauthorized",
 		})
 		return
 	}
+	if !token.allowsRequest(req) {
+		writeForbidden(req, resp, "write scope")
+		return
+	}
+	req.SetAttribute(InnerAuthCtx, token)
+	req.SetAttribute("user_id", token.Username())
 
 	chain.ProcessFilter(req, resp)
 }
 
+// GetAuthContext 获取 AuthFilter 验证后的用户信息，未经认证时返回 nil
+func GetAuthContext(req *restful.Request) *JWToken {
+	token, _ := req.Attribute(InnerAuthCtx).(*JWToken)
+	return token
+}
+
 // GetUserID 辅助函数，从 Context 获取用户ID
 func GetUserID(req *restful.Request) string {
 	val := req.Attribute("user_id")
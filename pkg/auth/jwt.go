@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	JWTClaimUsername JWTClaim = "username"
+	JWTClaimRoles    JWTClaim = "roles"
+	JWTClaimScope    JWTClaim = "scope"
+
+	// clockSkew 校验 exp/iat 时允许的时钟偏差
+	clockSkew = 30 * time.Second
+)
+
+var (
+	ErrTokenMissing = errors.New("token is missing")
+	ErrTokenInvalid = errors.New("token is invalid")
+)
+
+// jwtClaims token 载荷，除标准字段外携带用户名、角色和 scope
+type jwtClaims struct {
+	Username string        `json:"username"`
+	Roles    []string      `json:"roles"`
+	Scope    JWTTokenScope `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// ParseToken 验证签名（HS256/RS256）和 exp、iat、iss、sub、scope，返回 token 中的用户信息
+func (a *Authenticator) ParseToken(raw string) (*JWToken, error) {
+	if raw == "" {
+		return nil, ErrTokenMissing
+	}
+	ks := a.keys
+	if ks.Empty() {
+		return nil, fmt.Errorf("%w: %w", ErrTokenInvalid, ErrNoKeys)
+	}
+
+	claims := &jwtClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		switch t.Method.Alg() {
+		case jwt.SigningMethodHS256.Alg():
+			if key, ok := ks.hmacKey(kid); ok {
+				return key, nil
+			}
+		case jwt.SigningMethodRS256.Alg():
+			if key, ok := ks.rsaKey(kid); ok {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("no %s key for kid %q", t.Method.Alg(), kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithIssuer(DefaultIss),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTokenInvalid, err)
+	}
+	if claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: missing iat", ErrTokenInvalid)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrTokenInvalid)
+	}
+	if claims.Scope == "" {
+		return nil, fmt.Errorf("%w: missing scope", ErrTokenInvalid)
+	}
+	if claims.Username == "" {
+		return nil, fmt.Errorf("%w: missing username", ErrTokenInvalid)
+	}
+
+	return &JWToken{
+		username:  claims.Username,
+		roles:     claims.Roles,
+		scope:     claims.Scope,
+		expiredAt: claims.ExpiresAt.Unix(),
+		issuedAt:  claims.IssuedAt.Unix(),
+		iss:       claims.Issuer,
+		sub:       claims.Subject,
+	}, nil
+}
+
+// Username 用户名，即业务中的用户ID
+func (t *JWToken) Username() string { return t.username }
+
+// Roles 用户角色
+func (t *JWToken) Roles() []string { return slices.Clone(t.roles) }
+
+// Scope token 的授权范围
+func (t *JWToken) Scope() JWTTokenScope { return t.scope }
+
+// Subject token 的签发对象
+func (t *JWToken) Subject() string { return t.sub }
+
+// ExpiredAt 过期时间
+func (t *JWToken) ExpiredAt() time.Time { return time.Unix(t.expiredAt, 0) }
+
+// HasRole 是否拥有任一角色
+func (t *JWToken) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if slices.Contains(t.roles, role) {
+			return true
+		}
+	}
+	return false
+}
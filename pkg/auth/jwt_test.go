@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+var (
+	rsaKeysOnce sync.Once
+	rsaKeys     [2]*rsa.PrivateKey
+)
+
+// testRSAKey 测试共用的 RSA 私钥，只生成一次
+func testRSAKey(t *testing.T, i int) *rsa.PrivateKey {
+	t.Helper()
+	rsaKeysOnce.Do(func() {
+		for j := range rsaKeys {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			rsaKeys[j] = key
+		}
+	})
+	return rsaKeys[i]
+}
+
+// validClaims 能通过校验的载荷
+func validClaims() jwtClaims {
+	now := time.Now()
+	return jwtClaims{
+		Username: "alice",
+		Roles:    []string{UserRoleCVBasic},
+		Scope:    "user",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    DefaultIss,
+			Subject:   DefaultSub,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+// signClaims 用指定算法和密钥签发 token，kid 非空时写入头部
+func signClaims(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwtClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return raw
+}
+
+// writeFile 写入临时文件并返回路径
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rsaPublicPEM PKIX 格式的公钥
+func rsaPublicPEM(t *testing.T, key *rsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// rsaJWK RSA 公钥对应的 JWK
+func rsaJWK(kid, alg string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"alg": alg,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// writeJWKS 写入 JWKS 文件
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, "jwks.json", data)
+}
+
+func newAuthenticatorFor(t *testing.T, cfg KeyConfig) *Authenticator {
+	t.Helper()
+	keys, err := LoadKeySet(cfg)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	return NewAuthenticator(keys, nil, nil)
+}
+
+func TestParseTokenHS256(t *testing.T) {
+	a := newAuthenticatorFor(t, KeyConfig{HMACSecret: testSecret})
+	secret := []byte(testSecret)
+	hs256 := func(mutate func(c *jwtClaims)) string {
+		claims := validClaims()
+		if mutate != nil {
+			mutate(&claims)
+		}
+		return signClaims(t, jwt.SigningMethodHS256, secret, "", claims)
+	}
+
+	valid := hs256(nil)
+	parts := strings.Split(valid, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(payload), "alice", "admin", 1)))
+	tampered := strings.Join(parts, ".")
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr error
+	}{
+		{"valid", valid, nil},
+		{"missing", "", ErrTokenMissing},
+		{"garbage", "not.a.token", ErrTokenInvalid},
+		{"tampered payload", tampered, ErrTokenInvalid},
+		{"wrong secret", signClaims(t, jwt.SigningMethodHS256, []byte("other"), "", validClaims()), ErrTokenInvalid},
+		{"alg none", none, ErrTokenInvalid},
+		{"expired", hs256(func(c *jwtClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+		}), ErrTokenInvalid},
+		{"expired within clock skew", hs256(func(c *jwtClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-clockSkew / 2))
+		}), nil},
+		{"missing exp", hs256(func(c *jwtClaims) { c.ExpiresAt = nil }), ErrTokenInvalid},
+		{"missing iat", hs256(func(c *jwtClaims) { c.IssuedAt = nil }), ErrTokenInvalid},
+		{"issued in the future", hs256(func(c *jwtClaims) {
+			c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		}), ErrTokenInvalid},
+		{"wrong iss", hs256(func(c *jwtClaims) { c.Issuer = "someone-else" }), ErrTokenInvalid},
+		{"missing sub", hs256(func(c *jwtClaims) { c.Subject = "" }), ErrTokenInvalid},
+		{"missing scope", hs256(func(c *jwtClaims) { c.Scope = "" }), ErrTokenInvalid},
+		{"missing username", hs256(func(c *jwtClaims) { c.Username = "" }), ErrTokenInvalid},
+		{"RS256 without RSA keys", signClaims(t, jwt.SigningMethodRS256, testRSAKey(t, 0), "", validClaims()), ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := a.ParseToken(tt.raw)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseToken: %v", err)
+			}
+			if token.Username() != "alice" || token.Subject() != DefaultSub || token.Scope() != "user" || !token.HasRole(UserRoleCVBasic) {
+				t.Errorf("token = %+v", token)
+			}
+		})
+	}
+}
+
+func TestParseTokenRS256PEM(t *testing.T) {
+	key := testRSAKey(t, 0)
+	pemData := rsaPublicPEM(t, key)
+	a := newAuthenticatorFor(t, KeyConfig{RSAPublicKeyFile: writeFile(t, "key.pem", pemData)})
+
+	if _, err := a.ParseToken(signClaims(t, jwt.SigningMethodRS256, key, "", validClaims())); err != nil {
+		t.Errorf("RS256 token: %v", err)
+	}
+	if _, err := a.ParseToken(signClaims(t, jwt.SigningMethodRS256, testRSAKey(t, 1), "", validClaims())); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("RS256 token signed by another key: err = %v, want ErrTokenInvalid", err)
+	}
+	// 算法混淆：用公开的 RSA 公钥作为 HS256 密钥签名
+	if _, err := a.ParseToken(signClaims(t, jwt.SigningMethodHS256, pemData, "", validClaims())); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("HS256 token signed with the RSA public key: err = %v, want ErrTokenInvalid", err)
+	}
+	if _, err := a.ParseToken(signClaims(t, jwt.SigningMethodRS512, key, "", validClaims())); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("RS512 token: err = %v, want ErrTokenInvalid", err)
+	}
+}
+
+func TestParseTokenJWKS(t *testing.T) {
+	keyA, keyB := testRSAKey(t, 0), testRSAKey(t, 1)
+	hmacSecret := []byte("jwks-hmac-secret")
+	path := writeJWKS(t,
+		rsaJWK("a", "RS256", keyA),
+		rsaJWK("b", "", keyB),
+		map[string]string{"kty": "oct", "kid": "h", "alg": "HS256", "k": base64.RawURLEncoding.EncodeToString(hmacSecret)},
+		// 加密用途的密钥不用于验证签名
+		map[string]string{"kty": "EC", "kid": "enc", "use": "enc"},
+	)
+	a := newAuthenticatorFor(t, KeyConfig{JWKSFile: path})
+
+	tests := []struct {
+		name  string
+		raw   string
+		valid bool
+	}{
+		{"kid a", signClaims(t, jwt.SigningMethodRS256, keyA, "a", validClaims()), true},
+		{"kid b", signClaims(t, jwt.SigningMethodRS256, keyB, "b", validClaims()), true},
+		{"kid a signed by key b", signClaims(t, jwt.SigningMethodRS256, keyB, "a", validClaims()), false},
+		{"unknown kid", signClaims(t, jwt.SigningMethodRS256, keyA, "c", validClaims()), false},
+		{"no kid with several RSA keys", signClaims(t, jwt.SigningMethodRS256, keyA, "", validClaims()), false},
+		{"oct kid h", signClaims(t, jwt.SigningMethodHS256, hmacSecret, "h", validClaims()), true},
+		{"HS256 with RSA kid", signClaims(t, jwt.SigningMethodHS256, hmacSecret, "a", validClaims()), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.ParseToken(tt.raw)
+			if tt.valid && err != nil {
+				t.Errorf("ParseToken: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrTokenInvalid) {
+				t.Errorf("err = %v, want ErrTokenInvalid", err)
+			}
+		})
+	}
+}
+
+func TestLoadJWKSRejectsMismatchedKeys(t *testing.T) {
+	key := testRSAKey(t, 0)
+	tests := []struct {
+		name string
+		key  map[string]string
+	}{
+		{"RSA key for RS512", rsaJWK("a", "RS512", key)},
+		{"RSA key for HS256", rsaJWK("a", "HS256", key)},
+		{"oct key for RS256", map[string]string{"kty": "oct", "kid": "h", "alg": "RS256", "k": "c2VjcmV0"}},
+		{"EC key", map[string]string{"kty": "EC", "kid": "e", "alg": "ES256"}},
+		{"RSA key without modulus", map[string]string{"kty": "RSA", "kid": "a", "e": "AQAB"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadKeySet(KeyConfig{JWKSFile: writeJWKS(t, tt.key)}); err == nil {
+				t.Error("LoadKeySet: want error")
+			}
+		})
+	}
+
+	if _, err := LoadKeySet(KeyConfig{}); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("LoadKeySet without keys: err = %v, want ErrNoKeys", err)
+	}
+	if _, err := LoadKeySet(KeyConfig{RSAPublicKeyFile: writeFile(t, "bad.pem", []byte("not pem"))}); err == nil {
+		t.Error("LoadKeySet with a malformed PEM file: want error")
+	}
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// KeyConfig 验证 JWT 所用的密钥来源，可以同时配置多种
+type KeyConfig struct {
+	HMACSecret       string // HS256 共享密钥
+	RSAPublicKeyFile string // RS256 公钥，PEM 格式（PKIX 公钥或证书）
+	JWKSFile         string // 本地 JWKS 文件，按 kid 匹配，支持 RS256 的 RSA 密钥和 HS256 的 oct 密钥
+}
+
+// KeySet 已加载的验证密钥，kid 为空的密钥在 token 未携带 kid 时使用
+type KeySet struct {
+	hmacKeys map[string][]byte
+	rsaKeys  map[string]*rsa.PublicKey
+}
+
+// ErrNoKeys 没有配置任何验证密钥
+var ErrNoKeys = errors.New("no jwt verification keys configured")
+
+// LoadKeySet 按配置加载验证密钥
+func LoadKeySet(cfg KeyConfig) (*KeySet, error) {
+	ks := &KeySet{
+		hmacKeys: make(map[string][]byte),
+		rsaKeys:  make(map[string]*rsa.PublicKey),
+	}
+	if cfg.HMACSecret != "" {
+		ks.hmacKeys[""] = []byte(cfg.HMACSecret)
+	}
+	if cfg.RSAPublicKeyFile != "" {
+		key, err := loadRSAPublicKey(cfg.RSAPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		ks.rsaKeys[""] = key
+	}
+	if cfg.JWKSFile != "" {
+		if err := ks.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	if ks.Empty() {
+		return nil, ErrNoKeys
+	}
+	return ks, nil
+}
+
+// Empty 是否没有任何密钥
+func (ks *KeySet) Empty() bool {
+	return ks == nil || len(ks.hmacKeys)+len(ks.rsaKeys) == 0
+}
+
+// hmacKey 按 kid 查找 HS256 密钥；token 没有 kid 且只有一个密钥时使用该密钥
+func (ks *KeySet) hmacKey(kid string) ([]byte, bool) {
+	if key, ok := ks.hmacKeys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(ks.hmacKeys) == 1 {
+		for _, key := range ks.hmacKeys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// rsaKey 按 kid 查找 RS256 公钥；token 没有 kid 且只有一个公钥时使用该公钥
+func (ks *KeySet) rsaKey(kid string) (*rsa.PublicKey, bool) {
+	if key, ok := ks.rsaKeys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(ks.rsaKeys) == 1 {
+		for _, key := range ks.rsaKeys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// loadRSAPublicKey 读取 PEM 格式的 RSA 公钥或证书
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	var pub any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		pub = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA public key", path)
+	}
+	return key, nil
+}
+
+// jwk JWKS 中的单个密钥
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// loadJWKS 读取本地 JWKS 文件，忽略非签名用途的密钥
+// 只支持 RSA（RS256）和 oct（HS256）密钥，alg 与密钥类型不符或密钥类型不支持时报错，不会按其它算法使用
+func (ks *KeySet) loadJWKS(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			if k.Alg != "" && k.Alg != "RS256" {
+				return fmt.Errorf("%s: key %q: alg %q is not supported for RSA keys, want RS256", path, k.Kid, k.Alg)
+			}
+			key, err := k.rsaPublicKey()
+			if err != nil {
+				return fmt.Errorf("%s: key %q: %w", path, k.Kid, err)
+			}
+			ks.rsaKeys[k.Kid] = key
+		case "oct":
+			if k.Alg != "" && k.Alg != "HS256" {
+				return fmt.Errorf("%s: key %q: alg %q is not supported for oct keys, want HS256", path, k.Kid, k.Alg)
+			}
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return fmt.Errorf("%s: key %q: %w", path, k.Kid, err)
+			}
+			ks.hmacKeys[k.Kid] = secret
+		default:
+			return fmt.Errorf("%s: key %q: unsupported kty %q", path, k.Kid, k.Kty)
+		}
+	}
+	return nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if len(n) == 0 || len(e) == 0 {
+		return nil, errors.New("missing modulus or exponent")
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent too large")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
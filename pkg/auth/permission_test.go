@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	tokens := map[string]*JWToken{
+		"admin":        {roles: []string{UserRoleAdmin}},
+		"sophon admin": {roles: []string{UserRoleSophonAdmin}},
+		"basic":        {roles: []string{UserRoleCVBasic}},
+		"guest":        {roles: []string{UserRoleGuest}},
+		"no role":      {},
+	}
+	restricted := DefaultRoleMatrix()
+	restricted[PermDelete] = []string{UserRoleAdmin, UserRoleCVBasic}
+
+	tests := []struct {
+		name    string
+		matrix  RoleMatrix
+		perm    Permission
+		allowed []string
+	}{
+		{"default admin", nil, PermAdmin, []string{"admin", "sophon admin"}},
+		{"default read_all", nil, PermReadAll, []string{"admin", "sophon admin"}},
+		{"default delete is open to every user", nil, PermDelete, []string{"admin", "sophon admin", "basic", "guest", "no role"}},
+		{"restricted delete", restricted, PermDelete, []string{"admin", "basic"}},
+		{"unknown permission", nil, "export", nil},
+	}
+	for _, tt := range tests {
+		a := NewAuthenticator(nil, tt.matrix, nil)
+		for name, token := range tokens {
+			if got, want := a.Allowed(token, tt.perm), slices.Contains(tt.allowed, name); got != want {
+				t.Errorf("%s: Allowed(%s) = %v, want %v", tt.name, name, got, want)
+			}
+		}
+		if a.Allowed(nil, tt.perm) {
+			t.Errorf("%s: Allowed(nil) = true", tt.name)
+		}
+	}
+}
+
+func TestBuildRoleMatrix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roles.json")
+	err := os.WriteFile(path, []byte(`{"admin": ["ops"], "read_all": ["auditor"]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := DefaultRoleMatrix()
+
+	tests := []struct {
+		name      string
+		path      string
+		overrides RoleMatrix
+		want      RoleMatrix
+	}{
+		{
+			name: "defaults",
+			want: defaults,
+		},
+		{
+			name: "file replaces listed permissions",
+			path: path,
+			want: RoleMatrix{
+				PermAdmin:   {"ops"},
+				PermReadAll: {"auditor"},
+				PermDelete:  defaults[PermDelete],
+			},
+		},
+		{
+			name:      "overrides win over file",
+			path:      path,
+			overrides: RoleMatrix{PermReadAll: {"ops"}, PermDelete: {UserRoleAdmin}},
+			want: RoleMatrix{
+				PermAdmin:   {"ops"},
+				PermReadAll: {"ops"},
+				PermDelete:  {UserRoleAdmin},
+			},
+		},
+		{
+			name:      "overrides without file",
+			overrides: RoleMatrix{PermAdmin: {"ops"}},
+			want: RoleMatrix{
+				PermAdmin:   {"ops"},
+				PermReadAll: defaults[PermReadAll],
+				PermDelete:  defaults[PermDelete],
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildRoleMatrix(tt.path, tt.overrides)
+			if err != nil {
+				t.Fatalf("BuildRoleMatrix: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("matrix = %v, want %v", got, tt.want)
+			}
+			for perm, roles := range tt.want {
+				if !slices.Equal(got[perm], roles) {
+					t.Errorf("%s = %v, want %v", perm, got[perm], roles)
+				}
+			}
+		})
+	}
+
+	if _, err := BuildRoleMatrix(filepath.Join(t.TempDir(), "missing.json"), nil); err == nil {
+		t.Error("BuildRoleMatrix with a missing file: want error")
+	}
+}
@@ -0,0 +1,52 @@
+package streambus
+
+import (
+	"context"
+	"errors"
+)
+
+// EventType 流事件类型
+type EventType string
+
+const (
+	EventChunk    EventType = "chunk"    // 新生成的chunk
+	EventComplete EventType = "complete" // 生成完成
+	EventBreak    EventType = "break"    // 生成中断
+)
+
+// Event 流事件，同一个流内按发布顺序投递
+type Event struct {
+	Type    EventType `json:"type"`
+	ChunkID int       `json:"chunk_id"`
+	Content string    `json:"content"`
+}
+
+// Terminal 是否为结束事件
+func (e Event) Terminal() bool {
+	return e.Type == EventComplete || e.Type == EventBreak
+}
+
+// ErrNotFound 流不存在或已过期
+var ErrNotFound = errors.New("streambus: stream not found")
+
+// Bus 跨实例的流事件总线
+// 生成所在实例（owner）发布事件，其它实例通过 Snapshot + Subscribe 镜像该流，
+// 并通过 RequestBreak 请求 owner 中断生成
+type Bus interface {
+	// Open 声明本实例开始生成该流
+	Open(ctx context.Context, key, owner string) error
+	// Publish 追加事件，发布结束事件后该流不再处于生成中
+	Publish(ctx context.Context, key string, ev Event) error
+	// Owner 返回正在生成该流的实例，流不在生成中时返回 ErrNotFound
+	Owner(ctx context.Context, key string) (string, error)
+	// Snapshot 返回已发布的全部事件，以及用于 Subscribe 续读的游标
+	Snapshot(ctx context.Context, key string) ([]Event, string, error)
+	// Subscribe 从游标之后开始投递事件，投递结束事件或 ctx 取消后关闭通道
+	// owner 消失且没有结束事件时投递一个中断事件
+	Subscribe(ctx context.Context, key, cursor string) (<-chan Event, error)
+	// RequestBreak 广播中断请求，由持有该流的实例处理
+	RequestBreak(ctx context.Context, key string) error
+	// BreakRequests 接收中断请求的流 key，ctx 取消后关闭通道
+	BreakRequests(ctx context.Context) (<-chan string, error)
+	Close() error
+}
@@ -0,0 +1,183 @@
+package streambus
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// memoryStream 进程内保存的单个流
+type memoryStream struct {
+	owner  string
+	events []Event
+	base   int // 已丢弃的事件数，游标按总事件序号计
+	done   bool
+	notify chan struct{} // 有新事件时关闭并替换
+}
+
+// MemoryBus 进程内实现，单实例部署时使用
+type MemoryBus struct {
+	mu       sync.Mutex
+	streams  map[string]*memoryStream
+	breakSub map[chan string]struct{}
+	window   int
+}
+
+// defaultMemoryWindow 未指定时每个流保留的事件数
+const defaultMemoryWindow = 2000
+
+// NewMemoryBus 创建进程内总线，每个流最多保留最近 window 个事件，
+// 落后更多的订阅者从保留的第一个事件继续；window 不大于 0 时使用默认值
+func NewMemoryBus(window int) *MemoryBus {
+	if window <= 0 {
+		window = defaultMemoryWindow
+	}
+	return &MemoryBus{
+		streams:  make(map[string]*memoryStream),
+		breakSub: make(map[chan string]struct{}),
+		window:   window,
+	}
+}
+
+func (b *MemoryBus) Open(ctx context.Context, key, owner string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.streams[key] = &memoryStream{owner: owner, notify: make(chan struct{})}
+	return nil
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, key string, ev Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.streams[key]
+	if !ok || s.done {
+		return ErrNotFound
+	}
+	s.events = append(s.events, ev)
+	if drop := len(s.events) - b.window; drop > 0 {
+		// 底层数组在下次扩容时只复制保留的事件
+		s.events = s.events[drop:]
+		s.base += drop
+	}
+	if ev.Terminal() {
+		// 已结束的流由镜像读完后即可丢弃
+		s.done = true
+		delete(b.streams, key)
+	}
+	close(s.notify)
+	s.notify = make(chan struct{})
+	return nil
+}
+
+func (b *MemoryBus) Owner(ctx context.Context, key string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.streams[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return s.owner, nil
+}
+
+func (b *MemoryBus) Snapshot(ctx context.Context, key string) ([]Event, string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.streams[key]
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+	events := append([]Event(nil), s.events...)
+	return events, strconv.Itoa(s.base + len(events)), nil
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, key, cursor string) (<-chan Event, error) {
+	b.mu.Lock()
+	s, ok := b.streams[key]
+	b.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	next, err := strconv.Atoi(cursor)
+	if err != nil || next < 0 {
+		next = 0
+	}
+
+	out := make(chan Event, 16)
+	go func() {
+		defer close(out)
+		for {
+			b.mu.Lock()
+			next = max(next, s.base)
+			pending := append([]Event(nil), s.events[min(next-s.base, len(s.events)):]...)
+			next += len(pending)
+			notify := s.notify
+			b.mu.Unlock()
+
+			for _, ev := range pending {
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+				if ev.Terminal() {
+					return
+				}
+			}
+			select {
+			case <-notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (b *MemoryBus) RequestBreak(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.streams[key]; !ok {
+		return ErrNotFound
+	}
+	for ch := range b.breakSub {
+		select {
+		case ch <- key:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBus) BreakRequests(ctx context.Context) (<-chan string, error) {
+	ch := make(chan string, 16)
+	b.mu.Lock()
+	b.breakSub[ch] = struct{}{}
+	b.mu.Unlock()
+
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		defer func() {
+			b.mu.Lock()
+			delete(b.breakSub, ch)
+			b.mu.Unlock()
+		}()
+		for {
+			select {
+			case key := <-ch:
+				select {
+				case out <- key:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (b *MemoryBus) Close() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package streambus
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemoryBusWindow(t *testing.T) {
+	bus := NewMemoryBus(3)
+	ctx := context.Background()
+	if err := bus.Open(ctx, "s_m", "node-a"); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	// 订阅在发布前建立，游标指向已被丢弃的事件
+	early, err := bus.Subscribe(ctx, "s_m", "0")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	for i := range 5 {
+		if err := bus.Publish(ctx, "s_m", Event{Type: EventChunk, ChunkID: i}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	// 只保留最近 window 个事件，游标按总事件序号计
+	events, cursor, err := bus.Snapshot(ctx, "s_m")
+	if err != nil || len(events) != 3 || events[0].ChunkID != 2 || cursor != "5" {
+		t.Fatalf("Snapshot = %v, %q, %v; want chunks 2..4 at cursor 5", events, cursor, err)
+	}
+
+	late, err := bus.Subscribe(ctx, "s_m", cursor)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := bus.Publish(ctx, "s_m", Event{Type: EventComplete}); err != nil {
+		t.Fatalf("Publish complete: %v", err)
+	}
+	if ev, ok := recv(t, late); !ok || ev.Type != EventComplete {
+		t.Fatalf("late subscriber got %+v, %v; want complete", ev, ok)
+	}
+	if _, ok := recv(t, late); ok {
+		t.Error("late subscription not closed after terminal event")
+	}
+
+	// 落后的订阅者从保留的第一个事件继续，不会重复收到
+	var got []int
+	for ev := range early {
+		if ev.Type == EventChunk {
+			got = append(got, ev.ChunkID)
+		}
+	}
+	if len(got) == 0 || got[len(got)-1] != 4 {
+		t.Fatalf("early subscriber chunks = %v, want ending at 4", got)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] != got[i-1]+1 {
+			t.Fatalf("early subscriber chunks = %v, want consecutive", got)
+		}
+	}
+
+	// 结束后的流立即丢弃
+	if _, _, err := bus.Snapshot(ctx, "s_m"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Snapshot after complete: err = %v, want ErrNotFound", err)
+	}
+	if err := bus.Publish(ctx, "s_m", Event{Type: EventChunk}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Publish after complete: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,224 @@
+package streambus
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisOptions Redis 总线配置
+type RedisOptions struct {
+	Addr         string
+	Password     string
+	DB           int
+	Prefix       string        // key 前缀，默认 session-management
+	OwnerTTL     time.Duration // owner 标记的有效期，每次发布事件时续期，默认 10 分钟
+	StreamTTL    time.Duration // 事件流保留时间，默认 30 分钟
+	PollInterval time.Duration // XREAD 阻塞等待时间，超时后检查 owner 是否还在，默认 5 秒
+}
+
+// RedisBus 基于 Redis Streams 的实现
+// 每个流对应一个 Redis Stream 保存事件，owner 标记带过期时间，中断请求通过 Pub/Sub 广播
+type RedisBus struct {
+	client *redis.Client
+	opts   RedisOptions
+}
+
+// NewRedisBus 连接 Redis 并创建总线
+func NewRedisBus(opts RedisOptions) (*RedisBus, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "session-management"
+	}
+	if opts.OwnerTTL <= 0 {
+		opts.OwnerTTL = 10 * time.Minute
+	}
+	if opts.StreamTTL <= 0 {
+		opts.StreamTTL = 30 * time.Minute
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 5 * time.Second
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     opts.Addr,
+		Password: opts.Password,
+		DB:       opts.DB,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &RedisBus{client: client, opts: opts}, nil
+}
+
+func (b *RedisBus) streamKey(key string) string { return b.opts.Prefix + ":stream:" + key }
+func (b *RedisBus) ownerKey(key string) string  { return b.opts.Prefix + ":owner:" + key }
+func (b *RedisBus) breakChannel() string        { return b.opts.Prefix + ":breaks" }
+
+func (b *RedisBus) Open(ctx context.Context, key, owner string) error {
+	pipe := b.client.TxPipeline()
+	pipe.Del(ctx, b.streamKey(key))
+	pipe.Set(ctx, b.ownerKey(key), owner, b.opts.OwnerTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (b *RedisBus) Publish(ctx context.Context, key string, ev Event) error {
+	pipe := b.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.streamKey(key),
+		Values: map[string]any{
+			"type":     string(ev.Type),
+			"chunk_id": ev.ChunkID,
+			"content":  ev.Content,
+		},
+	})
+	pipe.Expire(ctx, b.streamKey(key), b.opts.StreamTTL)
+	if ev.Terminal() {
+		pipe.Del(ctx, b.ownerKey(key))
+	} else {
+		pipe.Expire(ctx, b.ownerKey(key), b.opts.OwnerTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (b *RedisBus) Owner(ctx context.Context, key string) (string, error) {
+	owner, err := b.client.Get(ctx, b.ownerKey(key)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	return owner, err
+}
+
+func (b *RedisBus) Snapshot(ctx context.Context, key string) ([]Event, string, error) {
+	messages, err := b.client.XRange(ctx, b.streamKey(key), "-", "+").Result()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(messages) == 0 {
+		if _, err := b.Owner(ctx, key); err != nil {
+			return nil, "", err
+		}
+		return nil, "0-0", nil
+	}
+	events := make([]Event, 0, len(messages))
+	for _, msg := range messages {
+		events = append(events, decodeEvent(msg))
+	}
+	return events, messages[len(messages)-1].ID, nil
+}
+
+func (b *RedisBus) Subscribe(ctx context.Context, key, cursor string) (<-chan Event, error) {
+	if cursor == "" {
+		cursor = "0-0"
+	}
+	out := make(chan Event, 16)
+	go func() {
+		defer close(out)
+		for ctx.Err() == nil {
+			streams, err := b.client.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{b.streamKey(key), cursor},
+				Count:   100,
+				Block:   b.opts.PollInterval,
+			}).Result()
+			if errors.Is(err, redis.Nil) {
+				// 等待超时：owner 已消失说明生成所在实例异常退出，按中断处理
+				if _, err := b.Owner(ctx, key); errors.Is(err, ErrNotFound) {
+					select {
+					case out <- Event{Type: EventBreak}:
+					case <-ctx.Done():
+					}
+					return
+				}
+				continue
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				select {
+				case <-time.After(b.opts.PollInterval):
+				case <-ctx.Done():
+				}
+				continue
+			}
+			for _, stream := range streams {
+				for _, msg := range stream.Messages {
+					cursor = msg.ID
+					ev := decodeEvent(msg)
+					select {
+					case out <- ev:
+					case <-ctx.Done():
+						return
+					}
+					if ev.Terminal() {
+						return
+					}
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (b *RedisBus) RequestBreak(ctx context.Context, key string) error {
+	if _, err := b.Owner(ctx, key); err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.breakChannel(), key).Err()
+}
+
+func (b *RedisBus) BreakRequests(ctx context.Context) (<-chan string, error) {
+	sub := b.client.Subscribe(ctx, b.breakChannel())
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		messages := sub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case out <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (b *RedisBus) Close() error {
+	return b.client.Close()
+}
+
+// decodeEvent 把 Redis Stream 条目还原为事件
+func decodeEvent(msg redis.XMessage) Event {
+	ev := Event{}
+	if v, ok := msg.Values["type"].(string); ok {
+		ev.Type = EventType(v)
+	}
+	if v, ok := msg.Values["chunk_id"].(string); ok {
+		ev.ChunkID, _ = strconv.Atoi(v)
+	}
+	if v, ok := msg.Values["content"].(string); ok {
+		ev.Content = v
+	}
+	return ev
+}
@@ -0,0 +1,174 @@
+package streambus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedisBus 连接进程内的 miniredis，测试结束时关闭
+func newTestRedisBus(t *testing.T, srv *miniredis.Miniredis, opts RedisOptions) *RedisBus {
+	t.Helper()
+	opts.Addr = srv.Addr()
+	bus, err := NewRedisBus(opts)
+	if err != nil {
+		t.Fatalf("NewRedisBus: %v", err)
+	}
+	t.Cleanup(func() { bus.Close() })
+	return bus
+}
+
+// recv 读取一个事件，超时视为失败
+func recv(t *testing.T, events <-chan Event) (Event, bool) {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		return ev, ok
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}, false
+	}
+}
+
+func TestRedisBusSnapshotAndSubscribe(t *testing.T) {
+	srv := miniredis.RunT(t)
+	bus := newTestRedisBus(t, srv, RedisOptions{PollInterval: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	if err := bus.Open(ctx, "s_m", "node-a"); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if owner, err := bus.Owner(ctx, "s_m"); err != nil || owner != "node-a" {
+		t.Fatalf("Owner = %q, %v; want node-a", owner, err)
+	}
+
+	// 没有事件时快照从头开始
+	events, cursor, err := bus.Snapshot(ctx, "s_m")
+	if err != nil || len(events) != 0 || cursor != "0-0" {
+		t.Fatalf("empty Snapshot = %v, %q, %v", events, cursor, err)
+	}
+
+	for i, content := range []string{"he", "llo"} {
+		if err := bus.Publish(ctx, "s_m", Event{Type: EventChunk, ChunkID: i, Content: content}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	events, cursor, err = bus.Snapshot(ctx, "s_m")
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	want := []Event{{Type: EventChunk, ChunkID: 0, Content: "he"}, {Type: EventChunk, ChunkID: 1, Content: "llo"}}
+	if len(events) != len(want) {
+		t.Fatalf("Snapshot returned %d events, want %d", len(events), len(want))
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+
+	// 从快照的游标订阅，只收到之后的事件，结束事件后关闭
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sub, err := bus.Subscribe(subCtx, "s_m", cursor)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	bus.Publish(ctx, "s_m", Event{Type: EventChunk, ChunkID: 2, Content: "!"})
+	bus.Publish(ctx, "s_m", Event{Type: EventComplete})
+
+	if ev, _ := recv(t, sub); ev != (Event{Type: EventChunk, ChunkID: 2, Content: "!"}) {
+		t.Errorf("first subscribed event = %+v", ev)
+	}
+	if ev, _ := recv(t, sub); ev.Type != EventComplete {
+		t.Errorf("second subscribed event = %+v, want complete", ev)
+	}
+	if _, ok := recv(t, sub); ok {
+		t.Error("subscription still open after terminal event")
+	}
+
+	// 结束事件清除 owner，事件流仍保留供续传
+	if _, err := bus.Owner(ctx, "s_m"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Owner after complete: err = %v, want ErrNotFound", err)
+	}
+	if events, _, err := bus.Snapshot(ctx, "s_m"); err != nil || len(events) != 4 {
+		t.Errorf("Snapshot after complete = %d events, %v; want 4", len(events), err)
+	}
+}
+
+func TestRedisBusSnapshotUnknownStream(t *testing.T) {
+	srv := miniredis.RunT(t)
+	bus := newTestRedisBus(t, srv, RedisOptions{})
+
+	if _, _, err := bus.Snapshot(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Snapshot err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRedisBusRequestBreak(t *testing.T) {
+	srv := miniredis.RunT(t)
+	owner := newTestRedisBus(t, srv, RedisOptions{})
+	other := newTestRedisBus(t, srv, RedisOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	breaks, err := owner.BreakRequests(ctx)
+	if err != nil {
+		t.Fatalf("BreakRequests: %v", err)
+	}
+
+	// 没有实例在生成的流不能中断
+	if err := other.RequestBreak(ctx, "s_m"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RequestBreak unknown stream: err = %v, want ErrNotFound", err)
+	}
+
+	if err := owner.Open(ctx, "s_m", "node-a"); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := other.RequestBreak(ctx, "s_m"); err != nil {
+		t.Fatalf("RequestBreak: %v", err)
+	}
+	select {
+	case key := <-breaks:
+		if key != "s_m" {
+			t.Errorf("break request for %q, want s_m", key)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for break request")
+	}
+}
+
+func TestRedisBusOwnerExpiry(t *testing.T) {
+	srv := miniredis.RunT(t)
+	bus := newTestRedisBus(t, srv, RedisOptions{OwnerTTL: time.Minute, PollInterval: 50 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := bus.Open(ctx, "s_m", "node-a"); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	bus.Publish(ctx, "s_m", Event{Type: EventChunk, ChunkID: 0, Content: "partial"})
+
+	sub, err := bus.Subscribe(ctx, "s_m", "")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if ev, _ := recv(t, sub); ev.Type != EventChunk || ev.Content != "partial" {
+		t.Fatalf("first event = %+v", ev)
+	}
+
+	// 生成所在实例异常退出，owner 过期后订阅方按中断处理
+	srv.FastForward(2 * time.Minute)
+	if _, err := bus.Owner(ctx, "s_m"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Owner after expiry: err = %v, want ErrNotFound", err)
+	}
+	if ev, _ := recv(t, sub); ev.Type != EventBreak {
+		t.Errorf("event after owner expiry = %+v, want break", ev)
+	}
+	if _, ok := recv(t, sub); ok {
+		t.Error("subscription still open after owner expiry")
+	}
+}
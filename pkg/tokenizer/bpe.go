@@ -0,0 +1,114 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pretokenizePattern 预切分规则，近似 cl100k 的切分方式（Go 正则不支持前瞻）
+var pretokenizePattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// BPE 字节级 BPE 分词器，词表为 tiktoken 格式：每行 "<base64 token> <rank>"
+type BPE struct {
+	name  string
+	ranks map[string]int
+}
+
+// LoadBPEFile 从本地词表文件加载 BPE 分词器
+func LoadBPEFile(name, path string) (*BPE, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<base64 token> <rank>\"", path, lineNo)
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: decode token: %w", path, lineNo, err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: parse rank: %w", path, lineNo, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s: empty vocabulary", path)
+	}
+	return &BPE{name: name, ranks: ranks}, nil
+}
+
+func (b *BPE) Name() string {
+	return b.name
+}
+
+func (b *BPE) Count(text string) int {
+	return len(b.Encode(text))
+}
+
+func (b *BPE) Encode(text string) []int {
+	var ids []int
+	for _, piece := range pretokenizePattern.FindAllString(text, -1) {
+		if rank, ok := b.ranks[piece]; ok {
+			ids = append(ids, rank)
+			continue
+		}
+		ids = append(ids, b.encodePiece([]byte(piece))...)
+	}
+	return ids
+}
+
+// encodePiece 对一个预切分片段做字节级合并，每次合并 rank 最小的相邻对
+func (b *BPE) encodePiece(piece []byte) []int {
+	// parts[i] 为第 i 个片段的起始偏移，末尾哨兵为 len(piece)
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+
+	for len(parts) > 2 {
+		minRank, minIdx := math.MaxInt, -1
+		for i := 0; i < len(parts)-2; i++ {
+			if rank, ok := b.ranks[string(piece[parts[i]:parts[i+2]])]; ok && rank < minRank {
+				minRank, minIdx = rank, i
+			}
+		}
+		if minIdx < 0 {
+			break
+		}
+		parts = append(parts[:minIdx+1], parts[minIdx+2:]...)
+	}
+
+	ids := make([]int, 0, len(parts)-1)
+	for i := 0; i < len(parts)-1; i++ {
+		if rank, ok := b.ranks[string(piece[parts[i]:parts[i+1]])]; ok {
+			ids = append(ids, rank)
+		} else {
+			// 词表缺少单字节时每个字节仍计为一个 token
+			ids = append(ids, -1)
+		}
+	}
+	return ids
+}
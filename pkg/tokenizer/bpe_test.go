@@ -0,0 +1,142 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testRanks 小词表：单字节 a b c d 空格，合并 ab < cd < abcd < bc
+// bc 的 rank 比 cd 大，用来验证每次合并 rank 最小的相邻对而不是从左到右合并
+var testRanks = []struct {
+	token string
+	rank  int
+}{
+	{"a", 0}, {"b", 1}, {"c", 2}, {"d", 3}, {" ", 4},
+	{"ab", 5}, {"cd", 6}, {"abcd", 7}, {"bc", 8},
+}
+
+// writeRankFile 写入 tiktoken 格式的词表文件并返回路径
+func writeRankFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ranks.tiktoken")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadTestBPE(t *testing.T) *BPE {
+	t.Helper()
+	var sb strings.Builder
+	for _, r := range testRanks {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(r.token)), r.rank)
+	}
+	// 空行会被跳过
+	sb.WriteString("\n")
+	bpe, err := LoadBPEFile("test", writeRankFile(t, sb.String()))
+	if err != nil {
+		t.Fatalf("LoadBPEFile: %v", err)
+	}
+	return bpe
+}
+
+func TestLoadBPEFile(t *testing.T) {
+	bpe := loadTestBPE(t)
+	if bpe.Name() != "test" {
+		t.Errorf("Name() = %q, want test", bpe.Name())
+	}
+	if len(bpe.ranks) != len(testRanks) {
+		t.Errorf("loaded %d ranks, want %d", len(bpe.ranks), len(testRanks))
+	}
+	for _, r := range testRanks {
+		if got, ok := bpe.ranks[r.token]; !ok || got != r.rank {
+			t.Errorf("rank of %q = %d, %v, want %d", r.token, got, ok, r.rank)
+		}
+	}
+}
+
+func TestLoadBPEFileMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"missing rank", "YQ==\n", ":1: expected"},
+		{"extra field", "YQ== 0 1\n", ":1: expected"},
+		{"bad base64", "YQ== 0\n!!! 1\n", ":2: decode token"},
+		{"bad rank", "YQ== zero\n", ":1: parse rank"},
+		{"empty", "\n\n", "empty vocabulary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadBPEFile("test", writeRankFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := LoadBPEFile("test", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadBPEFile with a missing file: want error")
+	}
+}
+
+func TestEncodePiece(t *testing.T) {
+	bpe := loadTestBPE(t)
+	tests := []struct {
+		piece string
+		want  []int
+	}{
+		{"a", []int{0}},
+		// ab -> ab c d -> ab cd -> abcd
+		{"abcd", []int{7}},
+		// ab(5) 先于 bc(8) 合并，abc 不在词表中
+		{"abc", []int{5, 2}},
+		// cd(6) 先于 bc(8) 合并，bcd 不在词表中
+		{"bcd", []int{1, 6}},
+		// 没有可合并的相邻对
+		{"dcba", []int{3, 2, 1, 0}},
+		// 词表缺少的字节各计为一个 token
+		{"ae", []int{0, -1}},
+		{"ee", []int{-1, -1}},
+		{"", []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.piece, func(t *testing.T) {
+			if got := bpe.encodePiece([]byte(tt.piece)); !slices.Equal(got, tt.want) {
+				t.Errorf("encodePiece(%q) = %v, want %v", tt.piece, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPEEncode(t *testing.T) {
+	bpe := loadTestBPE(t)
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"", nil},
+		// 整个片段在词表中时直接命中
+		{"abcd", []int{7}},
+		// 预切分为 "abcd" 和 " bcd"
+		{"abcd bcd", []int{7, 4, 1, 6}},
+		{"ab cd", []int{5, 4, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := bpe.Encode(tt.text)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+			if n := bpe.Count(tt.text); n != len(tt.want) {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, n, len(tt.want))
+			}
+		})
+	}
+}
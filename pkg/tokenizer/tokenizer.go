@@ -0,0 +1,84 @@
+package tokenizer
+
+import (
+	"sync"
+	"unicode"
+)
+
+// Tokenizer 分词器接口，用于统计消息的 token 数
+type Tokenizer interface {
+	Name() string
+	// Encode 把文本编码为 token id 序列
+	Encode(text string) []int
+	// Count 统计文本的 token 数
+	Count(text string) int
+}
+
+// Registry 分词器注册表，model -> Tokenizer
+type Registry struct {
+	byModel map[string]Tokenizer
+	def     Tokenizer
+	mu      sync.RWMutex
+}
+
+// NewRegistry 创建分词器注册表，def 为未注册模型使用的默认分词器，为 nil 时使用启发式分词器
+func NewRegistry(def Tokenizer) *Registry {
+	if def == nil {
+		def = Heuristic{}
+	}
+	return &Registry{byModel: make(map[string]Tokenizer), def: def}
+}
+
+// Register 为指定模型注册分词器
+func (r *Registry) Register(model string, t Tokenizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byModel[model] = t
+}
+
+// SetDefault 设置未注册模型使用的默认分词器
+func (r *Registry) SetDefault(t Tokenizer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.def = t
+}
+
+// ForModel 获取模型对应的分词器，未注册时返回默认分词器
+func (r *Registry) ForModel(model string) Tokenizer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if t, ok := r.byModel[model]; ok {
+		return t
+	}
+	return r.def
+}
+
+// Heuristic 启发式分词器，没有词表时的兜底实现
+// 中日韩字符按 1 个 token，其余字符按 4 个字符 1 个 token
+type Heuristic struct{}
+
+func (Heuristic) Name() string {
+	return "heuristic"
+}
+
+// Encode 启发式分词器没有词表，返回按 Count 长度的占位 id
+func (h Heuristic) Encode(text string) []int {
+	return make([]int, h.Count(text))
+}
+
+func (Heuristic) Count(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
@@ -0,0 +1,57 @@
+package tokenizer
+
+import "testing"
+
+func TestHeuristicCount(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"empty", "", 0},
+		{"one ascii char", "a", 1},
+		{"four ascii chars", "abcd", 1},
+		{"five ascii chars", "abcde", 2},
+		{"ascii sentence", "hello world", 3},
+		{"han", "你好世界", 4},
+		{"hiragana", "こんにちは", 5},
+		{"katakana", "カタカナ", 4},
+		{"hangul", "안녕", 2},
+		// 2 个汉字 + ", world" 7 个字符
+		{"mixed", "你好, world", 4},
+		// 全角标点不属于中日韩文字，按其它字符计
+		{"fullwidth punctuation", "，。", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h Heuristic
+			if got := h.Count(tt.text); got != tt.want {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+			if got := len(h.Encode(tt.text)); got != tt.want {
+				t.Errorf("len(Encode(%q)) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(nil)
+	if got := r.ForModel("gpt-4o").Name(); got != "heuristic" {
+		t.Errorf("default tokenizer = %s, want heuristic", got)
+	}
+
+	bpe := &BPE{name: "bpe", ranks: map[string]int{"a": 0}}
+	r.Register("gpt-4o", bpe)
+	if r.ForModel("gpt-4o") != bpe || r.ForModel("other").Name() != "heuristic" {
+		t.Error("registered tokenizer is not used only for its model")
+	}
+	r.SetDefault(bpe)
+	if r.ForModel("other") != bpe {
+		t.Error("default tokenizer not replaced")
+	}
+	// 注册表之间互不影响
+	if got := NewRegistry(nil).ForModel("gpt-4o").Name(); got != "heuristic" {
+		t.Errorf("new registry tokenizer = %s, want heuristic", got)
+	}
+}
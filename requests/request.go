@@ -63,6 +63,8 @@ type StreamChatReq struct {
 // 恢复流式对话请求结构
 type ResumeStreamChatReq struct {
 	MessageID string `json:"message_id"`
+	// 从该chunk序号开始重放（含），为空时使用 Last-Event-ID 请求头
+	FromChunk *int `json:"from_chunk"`
 }
 
 // 查询信息模型
@@ -76,3 +78,36 @@ type QueryInfoModel struct {
 type BreakStreamChatReq struct {
 	MessageID string `json:"message_id"`
 }
+
+// EditMessageReq 编辑用户消息并重发请求结构
+type EditMessageReq struct {
+	Query string           `json:"query"`
+	Files []my_models.File `json:"files"`
+}
+
+// SwitchBranchReq 切换激活分支请求结构
+type SwitchBranchReq struct {
+	MessageID string `json:"message_id"`
+}
+
+// WSCommandReq WebSocket 客户端命令
+type WSCommandReq struct {
+	Type      string `json:"type"`       // send / resume / break / regenerate / ping
+	RequestID string `json:"request_id"` // 客户端自定义的请求ID，服务端事件中原样带回
+	// resume / break / regenerate 的目标消息
+	MessageID string `json:"message_id"`
+	// resume 从该chunk序号开始重放（含），为空时从当前位置开始
+	FromChunk *int `json:"from_chunk"`
+	// send 的参数，与流式对话请求一致
+	ProjectId string         `json:"project_id"`
+	LastMsgID string         `json:"last_message_id"`
+	QueryInfo QueryInfoModel `json:"query_info"`
+}
+
+// CreateAPIKeyReq 签发个人 API key 请求结构
+type CreateAPIKeyReq struct {
+	Name          string   `json:"name"`
+	Scope         string   `json:"scope"`           // read / write，默认 read
+	ProjectIDs    []string `json:"project_ids"`     // 限定的项目，为空表示不限
+	ExpiresInDays int      `json:"expires_in_days"` // 有效天数，0 表示不过期
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	"session-management/models"
+	"time"
 
 	"github.com/emicklei/go-restful/v3"
 )
@@ -107,9 +108,40 @@ type UpdateProjectResponse struct {
 type DeleteProjectResponse struct {
 	Success bool `json:"success"`
 }
+
+// ListMessagesResponse 会话激活分支响应结构，Messages 为 root → 激活叶子的路径
 type ListMessagesResponse struct {
-	Messages         []models.Message `json:"messages"`
-	CurrentMessageId string           `json:"current_message_id"`
+	Messages         []MessageView `json:"messages"`
+	CurrentMessageId string        `json:"current_message_id"`
+}
+
+// MessageView 激活分支上的一条消息及其兄弟版本信息，用于渲染 "< 2/3 >" 版本切换
+type MessageView struct {
+	models.Message
+	SiblingIDs   []string `json:"sibling_ids"`   // 同一父消息下的所有版本，按创建时间升序
+	SiblingIndex int      `json:"sibling_index"` // 当前版本序号，从1开始
+	SiblingCount int      `json:"sibling_count"` // 版本总数
+}
+
+// MessageTreeResponse 会话消息树响应结构
+type MessageTreeResponse struct {
+	SessionID    string             `json:"session_id"`
+	ActiveLeafID string             `json:"active_leaf_id"` // 当前激活分支的叶子
+	TotalCount   int                `json:"total_count"`    // 未删除的消息总数
+	Roots        []*MessageTreeNode `json:"roots"`
+}
+
+// MessageTreeNode 消息树节点
+type MessageTreeNode struct {
+	ID         string             `json:"id"`
+	ParentID   *string            `json:"parent_id"`
+	Role       string             `json:"role"`
+	Status     string             `json:"status"`
+	Content    string             `json:"content"`
+	Truncated  bool               `json:"truncated"`   // 内容是否被截断
+	ChildCount int                `json:"child_count"` // 子消息数量，超出深度限制时 children 为空
+	Children   []*MessageTreeNode `json:"children"`
+	CreatedAt  time.Time          `json:"created_at"`
 }
 
 // MoveSessionToProjectResponse 移动会话到项目响应结构
@@ -127,6 +159,50 @@ type BreakStreamChatResponse struct {
 	Message string `json:"message"`
 }
 
+// TokenUsageResponse token 用量汇总响应结构
+type TokenUsageResponse struct {
+	MessageCount     int64 `json:"message_count"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// StreamStatus 流式生成状态
+type StreamStatus struct {
+	SessionID   string    `json:"session_id"`
+	MessageID   string    `json:"message_id"`
+	Instance    string    `json:"instance"`     // 所在实例
+	Remote      bool      `json:"remote"`       // 是否为其它实例上生成的流的镜像
+	ChunkCount  int       `json:"chunk_count"`  // 已生成的chunk数
+	ClientCount int       `json:"client_count"` // 当前连接的客户端数
+	AgeSeconds  int64     `json:"age_seconds"`  // 创建至今的秒数
+	IsBreak     bool      `json:"is_break"`
+	IsCompleted bool      `json:"is_completed"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ListStreamsResponse 流状态列表响应结构
+type ListStreamsResponse struct {
+	Count   int            `json:"count"`
+	Streams []StreamStatus `json:"streams"`
+}
+
+// WSEvent WebSocket 服务端事件
+// 流事件（connected/chunk/complete/lagged）与 SSE 的事件名和数据一致，data 中带 message_id 区分不同的生成
+type WSEvent struct {
+	Event     string         `json:"event"`
+	ID        string         `json:"id,omitempty"`         // chunk 事件的序号，与 SSE 的 id 一致
+	RequestID string         `json:"request_id,omitempty"` // 触发该事件的命令的请求ID
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// CreateAPIKeyResponse 签发 API key 响应结构，明文 key 只返回这一次
+type CreateAPIKeyResponse struct {
+	Key    string        `json:"key"`
+	APIKey models.APIKey `json:"api_key"`
+}
+
 type CreateProjectResponse struct {
 	ProjectID string `json:"project_id"`
 }
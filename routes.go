@@ -0,0 +1,293 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"session-management/pkg/auth"
+	"session-management/requests"
+	"session-management/response"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+// NewWebService 注册所有接口及其认证、权限过滤器
+func NewWebService(app *Container) *restful.WebService {
+	ws := new(restful.WebService)
+	ws.Filter(app.Auth.AuthFilter)
+	ws.Filter(app.APIKeyHandler.APIKeyProjectFilter)
+	ws.
+		Path("/api/v1/applet/ai").
+		Consumes(restful.MIME_JSON, restful.MIME_XML).
+		Produces(restful.MIME_JSON, restful.MIME_XML)
+
+	// 路径参数模板（安全复用：restful 内部会复制参数）
+	projectIdParam := ws.PathParameter("projectId", "Project ID").DataType("string").Required(true)
+	sessionIdParam := ws.PathParameter("sessionId", "Session ID").DataType("string").Required(true)
+	// SSE 合并策略参数
+	flushIntervalParam := ws.QueryParameter("flush_interval_ms", "Batch chunks within this window in milliseconds, 0 sends immediately").DataType("integer")
+	flushBytesParam := ws.QueryParameter("flush_bytes", "Send early once batched content reaches this many bytes").DataType("integer")
+	heartbeatParam := ws.QueryParameter("heartbeat", "Heartbeat style while waiting: comment (default) or event").DataType("string")
+
+	//项目
+	//创建一个项目，指定标题（可选）
+	ws.Route(ws.POST("/projects").To(app.ProjectHandler.CreateProjectHandler).
+		Doc("Create a new project").
+		Param(ws.BodyParameter("request", "CreateAndUpdateProjectReq").
+			DataType(reflect.TypeFor[requests.CreateAndUpdateProjectReq]().String()).Required(true)).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
+
+	//更新项目
+	ws.Route(ws.PATCH("/projects/{projectId}").To(app.ProjectHandler.UpdateProjectHandler).
+		Doc("Update a project title").
+		Param(projectIdParam).
+		Param(ws.BodyParameter("request", "CreateAndUpdateProjectReq").DataType(reflect.TypeFor[requests.CreateAndUpdateProjectReq]().String())).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
+
+	//查询所有项目
+	ws.Route(ws.GET("/projects").To(app.ProjectHandler.ListProjectsHandler).
+		Doc("List all projects").
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
+
+	//删除一个项目
+	ws.Route(ws.DELETE("/projects/{projectId}").To(app.ProjectHandler.DeleteProjectHandler).
+		Filter(app.Auth.RequirePermission(auth.PermDelete)).
+		Doc("Delete a project").
+		Param(projectIdParam).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
+
+	// 查询某个项目下的所有会话
+	ws.Route(ws.GET("/projects/{projectId}/sessions").To(app.ProjectHandler.ListProjectSessionsHandler).
+		Doc("List all sessions under a project").
+		Param(projectIdParam).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}))
+
+	// 查询某个项目的token用量
+	ws.Route(ws.GET("/projects/{projectId}/usage").To(app.ProjectHandler.GetProjectUsageHandler).
+		Doc("Get token usage of a project").
+		Param(projectIdParam).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.TokenUsageResponse{}))
+
+	//会话
+	// 查询所有会话
+	ws.Route(ws.GET("/sessions").To(app.SessionHandler.ListAllSessionsHandler).
+		Doc("List all sessions").
+		Returns(200, "OK", response.CommonResponse{}).
+		Returns(401, "Unauthorized", nil).
+		Returns(403, "Forbidden", nil).
+		Returns(404, "Not Found", nil))
+	//删除一个会话
+	ws.Route(ws.DELETE("/sessions/{sessionId}").To(app.SessionHandler.DeleteSessionHandler).
+		Filter(app.Auth.RequirePermission(auth.PermDelete)).
+		Doc("Delete a session").
+		Param(sessionIdParam).
+		Returns(200, "OK", response.CommonResponse{}).
+		Returns(204, "No Content", nil).
+		Returns(400, "Bad Request", nil))
+
+	//修改会话标题
+	ws.Route(ws.PATCH("/sessions/{sessionId}").To(app.SessionHandler.UpdateSessionHandler).
+		Doc("Update a session title").
+		Param(sessionIdParam).
+		Param(ws.BodyParameter("request", "UpdateSessionReq").DataType("requests.UpdateSessionReq")).
+		Returns(200, "OK", response.CommonResponse{}).
+		Returns(400, "Bad Request", nil))
+
+	//查询某个会话激活分支上的消息
+	ws.Route(ws.GET("/sessions/{sessionId}/messages").To(app.SessionHandler.ListMessagesBySessionHandler).
+		Doc("Get session history on the active branch").
+		Param(sessionIdParam).
+		Returns(200, "OK", response.ListMessagesResponse{}).
+		Returns(400, "Bad Request", nil))
+
+	//查询某个会话的消息树
+	ws.Route(ws.GET("/sessions/{sessionId}/tree").To(app.SessionHandler.GetMessageTreeHandler).
+		Doc("Get the message tree of a session").
+		Param(sessionIdParam).
+		Param(ws.QueryParameter("root_id", "Only return the subtree rooted at this message").DataType("string")).
+		Param(ws.QueryParameter("max_depth", "Maximum depth, 0 means unlimited").DataType("integer")).
+		Param(ws.QueryParameter("content_limit", "Truncate content to this many characters, 0 means unlimited").DataType("integer")).
+		Returns(200, "OK", response.MessageTreeResponse{}).
+		Returns(400, "Bad Request", nil))
+
+	//切换会话的激活分支
+	ws.Route(ws.PUT("/sessions/{sessionId}/active-branch").To(app.SessionHandler.SwitchActiveBranchHandler).
+		Doc("Switch the active branch of a session").
+		Param(sessionIdParam).
+		Param(ws.BodyParameter("request", "SwitchBranchReq").DataType("requests.SwitchBranchReq")).
+		Returns(200, "OK", response.ListMessagesResponse{}).
+		Returns(400, "Bad Request", nil))
+
+	//查询某个会话的token用量
+	ws.Route(ws.GET("/sessions/{sessionId}/usage").To(app.SessionHandler.GetSessionUsageHandler).
+		Doc("Get token usage of a session").
+		Param(sessionIdParam).
+		Returns(200, "OK", response.TokenUsageResponse{}).
+		Returns(400, "Bad Request", nil))
+
+	// 获取不在项目里的会话
+	ws.Route(ws.GET("/sessions/unassigned").To(app.SessionHandler.ListSessionsNotInProjectHandler).
+		Doc("List all sessions not in project").
+		Returns(200, "OK", response.ListSessionsResponse{}).
+		Returns(400, "Bad Request", nil))
+
+	//移动一个会话到某个指定项目
+	ws.Route(ws.PUT("/sessions/{sessionId}/move").To(app.SessionHandler.MoveSessionToProjectHandler).
+		Doc("Move a session to a project").
+		Param(sessionIdParam).
+		Param(ws.BodyParameter("request", "MoveSessionToProjectReq").DataType("requests.MoveSessionToProjectReq")).
+		Returns(200, "OK", response.MoveSessionToProjectResponse{}).
+		Returns(400, "Bad Request", nil))
+
+	//查询会话正在进行的流式生成
+	ws.Route(ws.GET("/sessions/{sessionId}/streams").To(app.SessionHandler.ListSessionStreamsHandler).
+		Doc("List active streams of a session").
+		Param(sessionIdParam).
+		Returns(200, "OK", response.ListStreamsResponse{}).
+		Returns(400, "Bad Request", nil))
+
+	//============================================API key================================
+	//签发个人 API key，只允许 JWT 登录的用户操作
+	ws.Route(ws.POST("/api-keys").To(app.APIKeyHandler.CreateAPIKeyHandler).
+		Filter(auth.RequireJWT).
+		Doc("Issue a personal API key, the plaintext key is only returned once").
+		Param(ws.BodyParameter("request", "CreateAPIKeyReq").
+			DataType(reflect.TypeFor[requests.CreateAPIKeyReq]().String()).Required(true)).
+		Returns(http.StatusCreated, http.StatusText(http.StatusCreated), response.CreateAPIKeyResponse{}).
+		Returns(403, "Forbidden", nil))
+
+	//查询个人 API key
+	ws.Route(ws.GET("/api-keys").To(app.APIKeyHandler.ListAPIKeysHandler).
+		Filter(auth.RequireJWT).
+		Doc("List personal API keys").
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}).
+		Returns(403, "Forbidden", nil))
+
+	//吊销个人 API key
+	ws.Route(ws.DELETE("/api-keys/{keyId}").To(app.APIKeyHandler.RevokeAPIKeyHandler).
+		Filter(auth.RequireJWT).
+		Doc("Revoke a personal API key").
+		Param(ws.PathParameter("keyId", "API key ID").DataType("string").Required(true)).
+		Returns(http.StatusOK, http.StatusText(http.StatusOK), response.CommonResponse{}).
+		Returns(403, "Forbidden", nil).
+		Returns(404, "Not Found", nil))
+
+	//============================================管理接口================================
+	//查询本实例上的所有流
+	ws.Route(ws.GET("/admin/streams").To(app.AdminHandler.ListAllStreamsHandler).
+		Filter(app.Auth.RequirePermission(auth.PermReadAll)).
+		Doc("List all live streams (admin only)").
+		Returns(200, "OK", response.ListStreamsResponse{}).
+		Returns(403, "Forbidden", nil))
+
+	//强制中断任意流
+	ws.Route(ws.POST("/admin/streams/{sessionId}/{messageId}/break").To(app.AdminHandler.ForceBreakStreamHandler).
+		Filter(app.Auth.RequirePermission(auth.PermAdmin)).
+		Doc("Force break a stream (admin only)").
+		Param(sessionIdParam).
+		Param(ws.PathParameter("messageId", "Message ID").DataType("string").Required(true)).
+		Returns(200, "OK", nil).
+		Returns(403, "Forbidden", nil).
+		Returns(404, "Not Found", nil))
+
+	//中断接口
+	ws.Route(ws.POST("/sessions/{sessionId}/stream/break").
+		To(app.MessageHandler.BreakStreamChatHandler).
+		Doc("Break session chat ").
+		Param(sessionIdParam).
+		Param(ws.BodyParameter("request", "BreakStreamChatReq").
+			DataType("requests.BreakStreamChatReq")).
+		Returns(200, "OK", response.BreakStreamChatResponse{}))
+
+	//消息
+	//删除一条消息以及后续消息
+	ws.Route(ws.DELETE("/sessions/{sessionId}/messages/{messageId}").To(app.MessageHandler.DeleteMessageHandler).
+		Filter(app.Auth.RequirePermission(auth.PermDelete)).
+		Doc("Delete a message").
+		Param(ws.PathParameter("messageId", "Message ID").DataType("string").Required(true)).
+		Param(sessionIdParam).
+		Returns(200, "OK", nil).
+		Returns(204, "No Content", nil).
+		Returns(400, "Bad Request", nil))
+
+	//============================================流式接口================================
+	//创建一个会话并对话，sse流式响应
+	ws.Route(ws.POST("/sessions/stream").
+		Consumes(restful.MIME_JSON).
+		// Produces("text/event-stream").
+		To(app.SessionHandler.CreateSessioAndChatHandler).
+		Doc("Create session and chat (SSE)").
+		Param(ws.BodyParameter("request", "CreateSessionAndChatReq").
+			DataType(reflect.TypeFor[requests.CreateSessionAndChatReq]().String())).
+		Param(flushIntervalParam).
+		Param(flushBytesParam).
+		Param(heartbeatParam).
+		Returns(200, "OK", nil))
+
+	//在已有会话中对话
+	ws.Route(ws.POST("/sessions/{sessionId}/stream").
+		Consumes(restful.MIME_JSON).
+		// Produces("text/event-stream").
+		To(app.MessageHandler.NewChatHandler).
+		Doc("Chat in a session (SSE)").
+		Param(sessionIdParam).
+		Reads(requests.StreamChatReq{}).
+		// Param(ws.BodyParameter("request", "StreamChatReq").
+		// 	DataType("requests.StreamChatReq")).
+		Param(flushIntervalParam).
+		Param(flushBytesParam).
+		Param(heartbeatParam).
+		Returns(200, "OK", nil))
+
+	//resume接口
+	ws.Route(ws.POST("/sessions/{sessionId}/stream/resume").
+		To(app.MessageHandler.ResumeStreamChatHandler).
+		Doc("Resume session chat (SSE)").
+		Consumes(restful.MIME_JSON).
+		// Produces("text/event-stream").
+		Param(ws.PathParameter("sessionId", "Session ID").DataType("string").Required(true)).
+		Param(ws.BodyParameter("request", "ResumeStreamChatReq").
+			// DataType("my_requests.ResumeStreamChatReq")).
+			DataType("requests.ResumeStreamChatReq")).
+		Param(flushIntervalParam).
+		Param(flushBytesParam).
+		Param(heartbeatParam).
+		Returns(200, "OK", nil).
+		Returns(410, "Gone: stream expired, refetch the message", nil))
+
+	//重新生成某条回答，作为同一用户消息下的新版本
+	ws.Route(ws.POST("/sessions/{sessionId}/messages/{messageId}/regenerate").
+		To(app.MessageHandler.RegenerateStreamChatHandler).
+		Doc("Regenerate an assistant answer (SSE)").
+		Param(sessionIdParam).
+		Param(ws.PathParameter("messageId", "Message ID").DataType("string").Required(true)).
+		Param(flushIntervalParam).
+		Param(flushBytesParam).
+		Param(heartbeatParam).
+		Returns(200, "OK", nil))
+
+	//编辑用户消息并重发，创建新的分支
+	ws.Route(ws.POST("/sessions/{sessionId}/messages/{messageId}/edit").
+		Consumes(restful.MIME_JSON).
+		To(app.MessageHandler.EditAndResendStreamChatHandler).
+		Doc("Edit a user message and resend (SSE)").
+		Param(sessionIdParam).
+		Param(ws.PathParameter("messageId", "Message ID").DataType("string").Required(true)).
+		Param(ws.BodyParameter("request", "EditMessageReq").
+			DataType(reflect.TypeFor[requests.EditMessageReq]().String())).
+		Param(flushIntervalParam).
+		Param(flushBytesParam).
+		Param(heartbeatParam).
+		Returns(200, "OK", nil))
+
+	//会话的 WebSocket 连接，同一连接上发送、续传、中断、重新生成，可同时进行多个生成
+	ws.Route(ws.GET("/sessions/{sessionId}/ws").
+		To(app.MessageHandler.SessionWebSocketHandler).
+		Doc("Session WebSocket for send/resume/break/regenerate commands").
+		Param(sessionIdParam).
+		Param(flushIntervalParam).
+		Param(flushBytesParam).
+		Returns(101, "Switching Protocols", nil).
+		Returns(400, "Bad Request", nil))
+
+	return ws
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"session-management/config"
+	"session-management/dao"
+	"session-management/pkg/auth"
+	"session-management/pkg/streambus"
+	"session-management/requests"
+	"session-management/service"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testSecret = "test-secret"
+	apiPrefix  = "/api/v1/applet/ai"
+)
+
+// newTestApp 在临时 SQLite 库上构造应用，注册与线上相同的接口
+func newTestApp(t *testing.T, matrix auth.RoleMatrix) (*Container, *restful.Container) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "app.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := dao.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.LoadKeySet(auth.KeyConfig{HMACSecret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := newContainer(config.Default(), db, streambus.NewMemoryBus(0), keys, matrix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := restful.NewContainer()
+	container.Add(NewWebService(app))
+	return app, container
+}
+
+// signToken 签发测试用户 alice 的 token，roles 为 nil 时不携带角色
+func signToken(t *testing.T, roles []string) string {
+	t.Helper()
+	now := time.Now()
+	raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":      auth.DefaultIss,
+		"sub":      auth.DefaultSub,
+		"iat":      now.Unix(),
+		"exp":      now.Add(time.Hour).Unix(),
+		"scope":    "user",
+		"username": "alice",
+		"roles":    roles,
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// newRequest 构造以 token 调用接口的请求，body 为 JSON 请求体
+func newRequest(method, path, token, body string) *http.Request {
+	req := httptest.NewRequest(method, apiPrefix+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", restful.MIME_JSON)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// serveRequest 处理请求，返回状态码
+func serveRequest(container *restful.Container, req *http.Request) int {
+	rec := httptest.NewRecorder()
+	container.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// serve 以 token 无请求体地调用接口，返回状态码
+func serve(container *restful.Container, method, path, token string) int {
+	return serveRequest(container, newRequest(method, path, token, ""))
+}
+
+// gatedRoute 受权限控制的接口，allowed 为允许访问的用户
+type gatedRoute struct {
+	method, path string
+	allowed      []string
+}
+
+// checkGatedRoutes 未允许的用户返回 403，允许的用户通过过滤器交给处理函数（资源不存在时可能是 404 等）
+func checkGatedRoutes(t *testing.T, container *restful.Container, tokens map[string]string, routes []gatedRoute) {
+	t.Helper()
+	for _, route := range routes {
+		for name, token := range tokens {
+			code := serve(container, route.method, route.path, token)
+			allowed := slices.Contains(route.allowed, name)
+			if allowed && (code == http.StatusForbidden || code == http.StatusUnauthorized) {
+				t.Errorf("%s %s as %s: status %d, want allowed", route.method, route.path, name, code)
+			}
+			if !allowed && code != http.StatusForbidden {
+				t.Errorf("%s %s as %s: status %d, want 403", route.method, route.path, name, code)
+			}
+		}
+		if code := serve(container, route.method, route.path, ""); code != http.StatusUnauthorized {
+			t.Errorf("%s %s without token: status %d, want 401", route.method, route.path, code)
+		}
+	}
+}
+
+func testTokens(t *testing.T) map[string]string {
+	return map[string]string{
+		"admin":        signToken(t, []string{auth.UserRoleAdmin}),
+		"sophon admin": signToken(t, []string{auth.UserRoleSophonAdmin}),
+		"basic":        signToken(t, []string{auth.UserRoleCVBasic}),
+		"guest":        signToken(t, []string{auth.UserRoleGuest}),
+		"no role":      signToken(t, nil),
+	}
+}
+
+func TestGatedRoutesDefaultMatrix(t *testing.T) {
+	_, container := newTestApp(t, nil)
+	everyone := []string{"admin", "sophon admin", "basic", "guest", "no role"}
+	admins := []string{"admin", "sophon admin"}
+
+	checkGatedRoutes(t, container, testTokens(t), []gatedRoute{
+		// 删除只作用于自己的数据，默认对所有用户开放
+		{http.MethodDelete, "/projects/p1", everyone},
+		{http.MethodDelete, "/sessions/s1", everyone},
+		{http.MethodDelete, "/sessions/s1/messages/m1", everyone},
+		{http.MethodGet, "/admin/streams", admins},
+		{http.MethodPost, "/admin/streams/s1/m1/break", admins},
+		{http.MethodGet, "/projects", everyone},
+	})
+}
+
+func TestGatedRoutesConfiguredMatrix(t *testing.T) {
+	matrix, err := auth.BuildRoleMatrix("", auth.RoleMatrix{
+		auth.PermDelete: {auth.UserRoleAdmin, auth.UserRoleCVBasic},
+		auth.PermAdmin:  {auth.UserRoleSophonAdmin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, container := newTestApp(t, matrix)
+
+	checkGatedRoutes(t, container, testTokens(t), []gatedRoute{
+		{http.MethodDelete, "/projects/p1", []string{"admin", "basic"}},
+		{http.MethodDelete, "/sessions/s1", []string{"admin", "basic"}},
+		{http.MethodDelete, "/sessions/s1/messages/m1", []string{"admin", "basic"}},
+		{http.MethodGet, "/admin/streams", []string{"admin", "sophon admin"}},
+		{http.MethodPost, "/admin/streams/s1/m1/break", []string{"sophon admin"}},
+	})
+}
+
+func TestAPIKeyRoutesRequireJWT(t *testing.T) {
+	app, container := newTestApp(t, nil)
+	created, err := app.APIKeys.CreateAPIKey("alice", []string{auth.UserRoleAdmin}, &requests.CreateAPIKeyReq{
+		Name:  "ci",
+		Scope: service.APIKeyScopeWrite,
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	jwtToken := signToken(t, []string{auth.UserRoleAdmin})
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/api-keys"},
+		{http.MethodPost, "/api-keys"},
+		{http.MethodDelete, "/api-keys/" + created.APIKey.ID},
+	} {
+		if code := serve(container, route.method, route.path, created.Key); code != http.StatusForbidden {
+			t.Errorf("%s %s with an API key: status %d, want 403", route.method, route.path, code)
+		}
+	}
+	if code := serve(container, http.MethodGet, "/api-keys", jwtToken); code != http.StatusOK {
+		t.Errorf("GET /api-keys with a JWT: status %d, want 200", code)
+	}
+	// API key 保留签发时的角色，可以访问管理接口
+	if code := serve(container, http.MethodGet, "/admin/streams", created.Key); code != http.StatusOK {
+		t.Errorf("GET /admin/streams with an admin API key: status %d, want 200", code)
+	}
+}
+
+// createAPIKey 为 alice 签发 API key，返回明文
+func createAPIKey(t *testing.T, app *Container, scope string, projects ...string) string {
+	t.Helper()
+	created, err := app.APIKeys.CreateAPIKey("alice", []string{auth.UserRoleCVBasic}, &requests.CreateAPIKeyReq{
+		Name:       "test",
+		Scope:      scope,
+		ProjectIDs: projects,
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return created.Key
+}
+
+func TestAPIKeyScope(t *testing.T) {
+	app, container := newTestApp(t, nil)
+	read := createAPIKey(t, app, service.APIKeyScopeRead)
+	write := createAPIKey(t, app, service.APIKeyScopeWrite)
+
+	tests := []struct {
+		method, path string
+		upgrade      bool
+	}{
+		{http.MethodPost, "/projects", false},
+		{http.MethodPatch, "/sessions/s1", false},
+		{http.MethodDelete, "/sessions/s1", false},
+		{http.MethodPost, "/sessions/stream", false},
+		// WebSocket 可以发起对话，按写操作处理
+		{http.MethodGet, "/sessions/s1/ws", true},
+	}
+	for _, tt := range tests {
+		for name, key := range map[string]string{"read": read, "write": write} {
+			req := newRequest(tt.method, tt.path, key, "{}")
+			if tt.upgrade {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+			}
+			code := serveRequest(container, req)
+			if name == "read" && code != http.StatusForbidden {
+				t.Errorf("%s %s with a read key: status %d, want 403", tt.method, tt.path, code)
+			}
+			if name == "write" && (code == http.StatusForbidden || code == http.StatusUnauthorized) {
+				t.Errorf("%s %s with a write key: status %d, want allowed", tt.method, tt.path, code)
+			}
+		}
+	}
+
+	for _, path := range []string{"/projects", "/sessions"} {
+		if code := serve(container, http.MethodGet, path, read); code != http.StatusOK {
+			t.Errorf("GET %s with a read key: status %d, want 200", path, code)
+		}
+	}
+}
+
+func TestAPIKeyRevoked(t *testing.T) {
+	app, container := newTestApp(t, nil)
+	created, err := app.APIKeys.CreateAPIKey("alice", nil, &requests.CreateAPIKeyReq{Name: "test"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if code := serve(container, http.MethodGet, "/projects", created.Key); code != http.StatusOK {
+		t.Fatalf("GET /projects before revoking: status %d, want 200", code)
+	}
+	if err := app.APIKeys.RevokeAPIKey("alice", created.APIKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(container, http.MethodGet, "/projects", created.Key); code != http.StatusUnauthorized {
+		t.Errorf("GET /projects after revoking: status %d, want 401", code)
+	}
+}
+
+func TestAPIKeyProjectFilter(t *testing.T) {
+	app, container := newTestApp(t, nil)
+	var projects [2]string
+	for i := range projects {
+		project, err := app.Projects.CreateProject(&requests.CreateAndUpdateProjectReq{Title: "p"}, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		projects[i] = project.ID
+	}
+	var sessions [3]string
+	for i, projectID := range []string{projects[0], projects[1], ""} {
+		session, err := app.Sessions.CreateSession("alice", projectID, "hi")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions[i] = session.ID
+	}
+	scoped := createAPIKey(t, app, service.APIKeyScopeWrite, projects[0])
+	unscoped := createAPIKey(t, app, service.APIKeyScopeWrite)
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/projects/" + projects[0] + "/sessions", "", http.StatusOK},
+		{http.MethodGet, "/projects/" + projects[1] + "/sessions", "", http.StatusForbidden},
+		{http.MethodGet, "/sessions/" + sessions[0] + "/messages", "", http.StatusOK},
+		{http.MethodGet, "/sessions/" + sessions[1] + "/messages", "", http.StatusForbidden},
+		// 未归入项目的会话和无法确定项目的接口一律拒绝
+		{http.MethodGet, "/sessions/" + sessions[2] + "/messages", "", http.StatusForbidden},
+		{http.MethodGet, "/sessions", "", http.StatusForbidden},
+		// 只能把会话移到限定的项目中
+		{http.MethodPut, "/sessions/" + sessions[0] + "/move", `{"project_id":"` + projects[1] + `"}`, http.StatusForbidden},
+		{http.MethodPut, "/sessions/" + sessions[1] + "/move", `{"project_id":"` + projects[0] + `"}`, http.StatusForbidden},
+		{http.MethodPut, "/sessions/" + sessions[0] + "/move", `{"project_id":"` + projects[0] + `"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := serveRequest(container, newRequest(tt.method, tt.path, scoped, tt.body)); code != tt.want {
+			t.Errorf("%s %s with a scoped key: status %d, want %d", tt.method, tt.path, code, tt.want)
+		}
+	}
+
+	// 不限项目的 key 和 JWT 不受影响
+	for name, token := range map[string]string{"unscoped key": unscoped, "jwt": signToken(t, nil)} {
+		for _, path := range []string{"/sessions", "/sessions/" + sessions[1] + "/messages", "/projects/" + projects[1] + "/sessions"} {
+			if code := serve(container, http.MethodGet, path, token); code != http.StatusOK {
+				t.Errorf("GET %s with %s: status %d, want 200", path, name, code)
+			}
+		}
+	}
+}
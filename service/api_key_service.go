@@ -0,0 +1,167 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/pkg/auth"
+	"session-management/requests"
+	"session-management/response"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	APIKeyScopeRead  = "read"
+	APIKeyScopeWrite = "write"
+
+	// apiKeyDisplayLen 列表中展示的明文前缀长度
+	apiKeyDisplayLen = 8
+	// apiKeyTouchInterval 最近使用时间的更新间隔，避免每个请求都写库
+	apiKeyTouchInterval = time.Minute
+)
+
+var errAPIKeyInvalid = errors.New("api key is invalid, expired or revoked")
+
+// APIKeyService 个人 API key 服务
+type APIKeyService struct {
+	db *gorm.DB
+}
+
+// 创建 API key 服务
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// hashAPIKey API key 明文的 sha256，key 本身是高熵随机串，不需要加盐
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKeySecret 生成 sk- 开头的随机 key
+func newAPIKeySecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return auth.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CreateAPIKey 为用户签发 API key，明文只在返回值中出现一次
+// roles 为签发者当前的角色，API key 的权限不会超过签发者
+// 角色只来自 JWT，没有用户目录可以在使用时查询，因此 key 保留签发时的角色：
+// 用户被降级后已签发的 key 仍有原来的权限，需要吊销后重新签发
+func (s *APIKeyService) CreateAPIKey(userID string, roles []string, req *requests.CreateAPIKeyReq) (*response.CreateAPIKeyResponse, error) {
+	if req.Name == "" {
+		return nil, &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "API key 名称不能为空"}
+	}
+	if req.Scope == "" {
+		req.Scope = APIKeyScopeRead
+	}
+	if req.Scope != APIKeyScopeRead && req.Scope != APIKeyScopeWrite {
+		return nil, &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "scope 只能为 read 或 write"}
+	}
+	if req.ExpiresInDays < 0 {
+		return nil, &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "有效天数不能为负数"}
+	}
+
+	projectIDs := slices.Compact(slices.Sorted(slices.Values(req.ProjectIDs)))
+	if len(projectIDs) > 0 {
+		var count int64
+		err := s.db.Model(&models.Project{}).
+			Where("id IN ? AND user_id = ? AND deleted = ?", projectIDs, userID, false).
+			Count(&count).Error
+		if err != nil {
+			return nil, response.WrapError(500, "查询项目失败", err)
+		}
+		if int(count) != len(projectIDs) {
+			return nil, constant.ErrProjectNotFound
+		}
+	}
+
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return nil, response.WrapError(500, "生成 API key 失败", err)
+	}
+	key := models.APIKey{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Name:       req.Name,
+		Prefix:     secret[:apiKeyDisplayLen],
+		KeyHash:    hashAPIKey(secret),
+		Scope:      req.Scope,
+		ProjectIDs: projectIDs,
+		Roles:      roles,
+		CreatedAt:  time.Now(),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := key.CreatedAt.AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.db.Create(&key).Error; err != nil {
+		return nil, response.WrapError(500, "创建 API key 失败", err)
+	}
+	log.Printf("[INFO] User %s created api key %s (%s)", userID, key.ID, key.Scope)
+	return &response.CreateAPIKeyResponse{Key: secret, APIKey: key}, nil
+}
+
+// ListAPIKeys 查询用户的 API key，包含已吊销和已过期的
+func (s *APIKeyService) ListAPIKeys(userID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, response.WrapError(500, "查询 API key 失败", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey 吊销 API key，吊销后立即失效
+func (s *APIKeyService) RevokeAPIKey(userID, keyID string) error {
+	result := s.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return response.WrapError(500, "吊销 API key 失败", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return constant.ErrAPIKeyNotFound
+	}
+	log.Printf("[INFO] User %s revoked api key %s", userID, keyID)
+	return nil
+}
+
+// ResolveAPIKey 校验 API key：存在、未吊销、未过期，并更新最近使用时间
+func (s *APIKeyService) ResolveAPIKey(secret string) (*auth.JWToken, error) {
+	var key models.APIKey
+	err := s.db.Where("key_hash = ?", hashAPIKey(secret)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, errAPIKeyInvalid
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		err := s.db.Model(&models.APIKey{}).
+			Where("id = ?", key.ID).
+			Update("last_used_at", now).Error
+		if err != nil {
+			log.Printf("update api key %s last_used_at failed: %v", key.ID, err)
+		}
+	}
+
+	return auth.NewAPIKeyToken(key.UserID, key.Roles, key.Scope == APIKeyScopeWrite, key.ProjectIDs, key.ExpiresAt), nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/pkg/auth"
+	"session-management/requests"
+	"session-management/response"
+)
+
+func TestResolveAPIKey(t *testing.T) {
+	keys := NewAPIKeyService(openTestDB(t, &models.APIKey{}, &models.Project{}))
+	project := models.Project{ID: "p1", UserID: "alice", Title: "p"}
+	if err := keys.db.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	create := func(req requests.CreateAPIKeyReq) *response.CreateAPIKeyResponse {
+		t.Helper()
+		created, err := keys.CreateAPIKey("alice", []string{auth.UserRoleCVBasic}, &req)
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		return created
+	}
+
+	read := create(requests.CreateAPIKeyReq{Name: "read"})
+	write := create(requests.CreateAPIKeyReq{Name: "write", Scope: APIKeyScopeWrite, ProjectIDs: []string{"p1", "p1"}, ExpiresInDays: 1})
+	revoked := create(requests.CreateAPIKeyReq{Name: "revoked"})
+	if err := keys.RevokeAPIKey("alice", revoked.APIKey.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if err := keys.RevokeAPIKey("alice", revoked.APIKey.ID); !errors.Is(err, constant.ErrAPIKeyNotFound) {
+		t.Errorf("revoking twice: err = %v, want ErrAPIKeyNotFound", err)
+	}
+	expired := create(requests.CreateAPIKeyReq{Name: "expired", ExpiresInDays: 1})
+	if err := keys.db.Model(&models.APIKey{ID: expired.APIKey.ID}).Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := keys.ResolveAPIKey(read.Key)
+	if err != nil {
+		t.Fatalf("ResolveAPIKey(read): %v", err)
+	}
+	if !token.IsAPIKey() || token.Username() != "alice" || token.Scope() != auth.JWTTokenScopeAPIKeyRead ||
+		!token.HasRole(auth.UserRoleCVBasic) || len(token.Projects()) != 0 {
+		t.Errorf("read token = %+v", token)
+	}
+	token, err = keys.ResolveAPIKey(write.Key)
+	if err != nil {
+		t.Fatalf("ResolveAPIKey(write): %v", err)
+	}
+	if token.Scope() != auth.JWTTokenScopeAPIKeyWrite || !slices.Equal(token.Projects(), []string{"p1"}) ||
+		!token.CanAccessProject("p1") || token.CanAccessProject("p2") {
+		t.Errorf("write token = %+v", token)
+	}
+
+	for name, secret := range map[string]string{
+		"revoked": revoked.Key,
+		"expired": expired.Key,
+		"unknown": auth.APIKeyPrefix + "unknown",
+	} {
+		if _, err := keys.ResolveAPIKey(secret); !errors.Is(err, errAPIKeyInvalid) {
+			t.Errorf("ResolveAPIKey(%s): err = %v, want errAPIKeyInvalid", name, err)
+		}
+	}
+
+	// 校验成功后记录最近使用时间
+	var stored models.APIKey
+	if err := keys.db.First(&stored, "id = ?", read.APIKey.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastUsedAt == nil {
+		t.Error("last_used_at not updated")
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	keys := NewAPIKeyService(openTestDB(t, &models.APIKey{}, &models.Project{}))
+	tests := []struct {
+		name string
+		req  requests.CreateAPIKeyReq
+	}{
+		{"missing name", requests.CreateAPIKeyReq{}},
+		{"unknown scope", requests.CreateAPIKeyReq{Name: "k", Scope: "admin"}},
+		{"negative expiry", requests.CreateAPIKeyReq{Name: "k", ExpiresInDays: -1}},
+		// 只能限定到自己的项目
+		{"unknown project", requests.CreateAPIKeyReq{Name: "k", ProjectIDs: []string{"p1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keys.CreateAPIKey("alice", nil, &tt.req); err == nil {
+				t.Error("CreateAPIKey: want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/response"
+	"time"
+)
+
+// messageTree 会话中未删除消息的父子关系
+type messageTree struct {
+	byID     map[string]*models.Message
+	children map[string][]*models.Message // parentID -> 子消息，按创建时间升序
+	roots    []*models.Message            // 没有父消息的消息
+	latest   *models.Message              // 最新创建的消息
+}
+
+// loadMessageTree 加载会话中未删除的消息并建立父子关系
+func (s *MessageService) loadMessageTree(sessionID string) (*messageTree, error) {
+	messages, err := s.ListMessagesBySession("", sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &messageTree{
+		byID:     make(map[string]*models.Message, len(messages)),
+		children: make(map[string][]*models.Message),
+	}
+	all := make(map[string]*models.Message, len(messages))
+	for i := range messages {
+		all[messages[i].ID] = &messages[i]
+	}
+	// messages 已按 created_at 升序，子消息顺序即版本顺序
+	// 祖先链上有消息已删除（不在列表中）的消息连同其子树一起排除
+	for i := range messages {
+		msg := &messages[i]
+		if !reachesRoot(msg, all) {
+			continue
+		}
+		if msg.ParentID == nil {
+			tree.roots = append(tree.roots, msg)
+		} else {
+			tree.children[*msg.ParentID] = append(tree.children[*msg.ParentID], msg)
+		}
+		tree.byID[msg.ID] = msg
+		tree.latest = msg
+	}
+	return tree, nil
+}
+
+// reachesRoot 沿父消息能否走到根消息
+func reachesRoot(msg *models.Message, all map[string]*models.Message) bool {
+	for depth := 0; depth <= len(all); depth++ {
+		if msg.ParentID == nil {
+			return true
+		}
+		parent, ok := all[*msg.ParentID]
+		if !ok {
+			return false
+		}
+		msg = parent
+	}
+	// 父子关系成环
+	return false
+}
+
+// siblings 与 msg 同父的所有消息（包括自己）
+func (t *messageTree) siblings(msg *models.Message) []*models.Message {
+	if msg.ParentID != nil {
+		return t.children[*msg.ParentID]
+	}
+	return t.roots
+}
+
+// descendToLeaf 从 msg 向下走到叶子，每一层选最新的子消息
+func (t *messageTree) descendToLeaf(msg *models.Message) *models.Message {
+	for {
+		children := t.children[msg.ID]
+		if len(children) == 0 {
+			return msg
+		}
+		msg = children[len(children)-1]
+	}
+}
+
+// pathTo root → msg 的路径
+func (t *messageTree) pathTo(msg *models.Message) []*models.Message {
+	var path []*models.Message
+	for cur := msg; cur != nil; {
+		path = append(path, cur)
+		if cur.ParentID == nil {
+			break
+		}
+		cur = t.byID[*cur.ParentID]
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// activeLeaf 会话当前激活的叶子；记录的叶子不存在或已删除时退回到最新消息所在分支
+func (t *messageTree) activeLeaf(session *models.Session) *models.Message {
+	if session.ActiveLeafID != nil {
+		if msg, ok := t.byID[*session.ActiveLeafID]; ok {
+			return t.descendToLeaf(msg)
+		}
+	}
+	return t.latest
+}
+
+// buildConversationView 激活分支 root → leaf 的路径，附带每一层的兄弟版本信息
+func (t *messageTree) buildConversationView(leaf *models.Message) *response.ListMessagesResponse {
+	view := &response.ListMessagesResponse{Messages: []response.MessageView{}}
+	if leaf == nil {
+		return view
+	}
+	for _, msg := range t.pathTo(leaf) {
+		siblings := t.siblings(msg)
+		item := response.MessageView{
+			Message:      *msg,
+			SiblingIDs:   make([]string, 0, len(siblings)),
+			SiblingCount: len(siblings),
+		}
+		for i, sibling := range siblings {
+			item.SiblingIDs = append(item.SiblingIDs, sibling.ID)
+			if sibling.ID == msg.ID {
+				item.SiblingIndex = i + 1
+			}
+		}
+		view.Messages = append(view.Messages, item)
+	}
+	view.CurrentMessageId = leaf.ID
+	return view
+}
+
+// GetConversationView 查询会话当前激活分支
+func (s *MessageService) GetConversationView(userID, sessionID string) (*response.ListMessagesResponse, error) {
+	session, err := s.sessions.GetSessionById(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := s.loadMessageTree(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return tree.buildConversationView(tree.activeLeaf(session)), nil
+}
+
+// SwitchActiveBranch 切换会话的激活分支
+// messageID 可以是分支上的任意消息，激活叶子为沿最新子消息走到的末端
+func (s *MessageService) SwitchActiveBranch(userID, sessionID, messageID string) (*response.ListMessagesResponse, error) {
+	if _, err := s.sessions.GetSessionById(userID, sessionID); err != nil {
+		return nil, err
+	}
+	tree, err := s.loadMessageTree(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	msg, ok := tree.byID[messageID]
+	if !ok {
+		return nil, constant.ErrInvalidMessageID
+	}
+
+	leaf := tree.descendToLeaf(msg)
+	if err := s.setActiveLeaf(sessionID, leaf.ID); err != nil {
+		return nil, err
+	}
+	return tree.buildConversationView(leaf), nil
+}
+
+// MessageTreeOptions 消息树查询选项
+type MessageTreeOptions struct {
+	RootID       string // 只返回以该消息为根的子树，为空时返回整棵树
+	MaxDepth     int    // 最大深度，<=0 不限制；超出深度的节点只返回 child_count
+	ContentLimit int    // 内容最多保留的字符数，<=0 不截断
+}
+
+// GetMessageTree 查询会话的消息树，已删除的子树不返回
+func (s *MessageService) GetMessageTree(userID, sessionID string, opts MessageTreeOptions) (*response.MessageTreeResponse, error) {
+	session, err := s.sessions.GetSessionById(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := s.loadMessageTree(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := tree.roots
+	if opts.RootID != "" {
+		root, ok := tree.byID[opts.RootID]
+		if !ok {
+			return nil, constant.ErrInvalidMessageID
+		}
+		roots = []*models.Message{root}
+	}
+
+	treeResponse := &response.MessageTreeResponse{
+		SessionID:  sessionID,
+		TotalCount: len(tree.byID),
+		Roots:      make([]*response.MessageTreeNode, 0, len(roots)),
+	}
+	if leaf := tree.activeLeaf(session); leaf != nil {
+		treeResponse.ActiveLeafID = leaf.ID
+	}
+	for _, root := range roots {
+		treeResponse.Roots = append(treeResponse.Roots, tree.buildTreeNode(root, 1, opts))
+	}
+	return treeResponse, nil
+}
+
+// buildTreeNode 递归构建树节点
+func (t *messageTree) buildTreeNode(msg *models.Message, depth int, opts MessageTreeOptions) *response.MessageTreeNode {
+	children := t.children[msg.ID]
+	node := &response.MessageTreeNode{
+		ID:         msg.ID,
+		ParentID:   msg.ParentID,
+		Role:       msg.Role,
+		Status:     msg.Status,
+		Content:    msg.Content,
+		ChildCount: len(children),
+		Children:   []*response.MessageTreeNode{},
+		CreatedAt:  msg.CreatedAt,
+	}
+	if opts.ContentLimit > 0 {
+		if runes := []rune(msg.Content); len(runes) > opts.ContentLimit {
+			node.Content = string(runes[:opts.ContentLimit])
+			node.Truncated = true
+		}
+	}
+	if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+		return node
+	}
+	for _, child := range children {
+		node.Children = append(node.Children, t.buildTreeNode(child, depth+1, opts))
+	}
+	return node
+}
+
+// setActiveLeaf 持久化会话的激活叶子
+func (s *MessageService) setActiveLeaf(sessionID, leafID string) error {
+	err := s.db.Model(&models.Session{}).
+		Where("id = ?", sessionID).
+		Updates(map[string]any{"active_leaf_id": leafID, "updated_at": time.Now()}).Error
+	if err != nil {
+		return response.WrapError(500, "更新激活分支失败", err)
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/response"
+)
+
+// branchTestMessages 测试用的消息树，按创建顺序排列：
+//
+//	u1 ─┬─ a1 ── x(已删除) ── y
+//	    └─ a1b ── u2 ─┬─ a2
+//	                  └─ a2b
+//	u1b ── a1c
+//	z(父消息不存在)
+var branchTestMessages = []struct {
+	id, parent, role string
+	deleted          bool
+}{
+	{"u1", "", constant.RoleUser, false},
+	{"a1", "u1", constant.RoleAssistant, false},
+	{"a1b", "u1", constant.RoleAssistant, false},
+	{"u2", "a1b", constant.RoleUser, false},
+	{"a2", "u2", constant.RoleAssistant, false},
+	{"a2b", "u2", constant.RoleAssistant, false},
+	{"u1b", "", constant.RoleUser, false},
+	{"a1c", "u1b", constant.RoleAssistant, false},
+	{"x", "a1", constant.RoleUser, true},
+	{"y", "x", constant.RoleAssistant, false},
+	{"z", "missing", constant.RoleUser, false},
+}
+
+// newBranchTestService 在临时库中创建用户 u 的会话 s 及 branchTestMessages
+func newBranchTestService(t *testing.T) *MessageService {
+	t.Helper()
+	db := openTestDB(t, &models.Session{}, &models.Message{})
+	now := time.Now()
+	if err := db.Create(&models.Session{ID: "s", UserID: "u", Title: "t", CreatedAt: now, UpdatedAt: now}).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for i, m := range branchTestMessages {
+		msg := &models.Message{
+			ID:        m.id,
+			SessionID: "s",
+			Role:      m.role,
+			Content:   "content of " + m.id,
+			Status:    constant.MessageStatusCompleted,
+			Deleted:   m.deleted,
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+			UpdatedAt: now,
+		}
+		if m.parent != "" {
+			msg.ParentID = &m.parent
+		}
+		if err := db.Create(msg).Error; err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+	}
+	return NewMessageService(db, NewSessionService(db, nil))
+}
+
+func loadBranchTestTree(t *testing.T) *messageTree {
+	t.Helper()
+	tree, err := newBranchTestService(t).loadMessageTree("s")
+	if err != nil {
+		t.Fatalf("loadMessageTree: %v", err)
+	}
+	return tree
+}
+
+func TestReachesRoot(t *testing.T) {
+	parent := func(id string) *string { return &id }
+	all := map[string]*models.Message{
+		"root":   {ID: "root"},
+		"child":  {ID: "child", ParentID: parent("root")},
+		"grand":  {ID: "grand", ParentID: parent("child")},
+		"orphan": {ID: "orphan", ParentID: parent("deleted")},
+		"below":  {ID: "below", ParentID: parent("orphan")},
+		"loop1":  {ID: "loop1", ParentID: parent("loop2")},
+		"loop2":  {ID: "loop2", ParentID: parent("loop1")},
+		"self":   {ID: "self", ParentID: parent("self")},
+	}
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"root", true},
+		{"child", true},
+		{"grand", true},
+		{"orphan", false},
+		{"below", false},
+		{"loop1", false},
+		{"self", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := reachesRoot(all[tt.id], all); got != tt.want {
+				t.Errorf("reachesRoot(%s) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMessageTree(t *testing.T) {
+	tree := loadBranchTestTree(t)
+	// 已删除的 x、其子消息 y 和父消息不存在的 z 都不在树中
+	for _, id := range []string{"x", "y", "z"} {
+		if _, ok := tree.byID[id]; ok {
+			t.Errorf("%s should be excluded from the tree", id)
+		}
+	}
+	if len(tree.byID) != 8 {
+		t.Errorf("tree has %d messages, want 8", len(tree.byID))
+	}
+	if len(tree.roots) != 2 || tree.roots[0].ID != "u1" || tree.roots[1].ID != "u1b" {
+		t.Errorf("roots = %v, want u1 u1b", tree.roots)
+	}
+	if tree.latest.ID != "a1c" {
+		t.Errorf("latest = %s, want a1c", tree.latest.ID)
+	}
+}
+
+func TestActiveLeaf(t *testing.T) {
+	tree := loadBranchTestTree(t)
+	tests := []struct {
+		name       string
+		activeLeaf string
+		want       string
+	}{
+		{"not set falls back to the latest message", "", "a1c"},
+		{"leaf", "a2", "a2"},
+		// 记录的是中间消息时沿最新的子消息走到叶子
+		{"inner message", "u2", "a2b"},
+		{"root", "u1", "a2b"},
+		{"deleted message", "x", "a1c"},
+		{"below a deleted message", "y", "a1c"},
+		{"unknown message", "gone", "a1c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &models.Session{ID: "s"}
+			if tt.activeLeaf != "" {
+				session.ActiveLeafID = &tt.activeLeaf
+			}
+			if got := tree.activeLeaf(session); got == nil || got.ID != tt.want {
+				t.Errorf("activeLeaf = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildConversationView(t *testing.T) {
+	tree := loadBranchTestTree(t)
+	view := tree.buildConversationView(tree.byID["a2"])
+	if view.CurrentMessageId != "a2" {
+		t.Errorf("CurrentMessageId = %s, want a2", view.CurrentMessageId)
+	}
+
+	want := []struct {
+		id       string
+		siblings string
+		index    int
+	}{
+		{"u1", "u1 u1b", 1},
+		{"a1b", "a1 a1b", 2},
+		{"u2", "u2", 1},
+		{"a2", "a2 a2b", 1},
+	}
+	if len(view.Messages) != len(want) {
+		t.Fatalf("view has %d messages, want %d", len(view.Messages), len(want))
+	}
+	for i, w := range want {
+		got := view.Messages[i]
+		if got.ID != w.id || strings.Join(got.SiblingIDs, " ") != w.siblings ||
+			got.SiblingIndex != w.index || got.SiblingCount != len(got.SiblingIDs) {
+			t.Errorf("message %d = %s siblings [%s] %d/%d, want %s siblings [%s] %d",
+				i, got.ID, strings.Join(got.SiblingIDs, " "), got.SiblingIndex, got.SiblingCount, w.id, w.siblings, w.index)
+		}
+	}
+
+	// a1 下唯一的子消息已删除，a1 即为叶子
+	if view := tree.buildConversationView(tree.byID["a1"]); len(view.Messages) != 2 || view.Messages[1].SiblingIndex != 1 {
+		t.Errorf("view of a1 = %+v", view.Messages)
+	}
+	if view := tree.buildConversationView(nil); len(view.Messages) != 0 || view.CurrentMessageId != "" {
+		t.Errorf("view of nil leaf = %+v", view)
+	}
+}
+
+func TestSwitchActiveBranch(t *testing.T) {
+	messages := newBranchTestService(t)
+
+	tests := []struct {
+		messageID string
+		wantLeaf  string
+		wantPath  string
+	}{
+		{"a1", "a1", "u1 a1"},
+		{"u2", "a2b", "u1 a1b u2 a2b"},
+		{"u1b", "a1c", "u1b a1c"},
+		{"a2", "a2", "u1 a1b u2 a2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.messageID, func(t *testing.T) {
+			view, err := messages.SwitchActiveBranch("u", "s", tt.messageID)
+			if err != nil {
+				t.Fatalf("SwitchActiveBranch: %v", err)
+			}
+			var ids []string
+			for _, msg := range view.Messages {
+				ids = append(ids, msg.ID)
+			}
+			if path := strings.Join(ids, " "); view.CurrentMessageId != tt.wantLeaf || path != tt.wantPath {
+				t.Errorf("view = %s with current %s, want %s", path, view.CurrentMessageId, tt.wantPath)
+			}
+
+			// 切换结果持久化，之后查询激活分支得到相同的视图
+			session, err := messages.sessions.GetSessionById("u", "s")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.ActiveLeafID == nil || *session.ActiveLeafID != tt.wantLeaf {
+				t.Errorf("stored active leaf = %v, want %s", session.ActiveLeafID, tt.wantLeaf)
+			}
+			current, err := messages.GetConversationView("u", "s")
+			if err != nil {
+				t.Fatalf("GetConversationView: %v", err)
+			}
+			if current.CurrentMessageId != tt.wantLeaf {
+				t.Errorf("GetConversationView leaf = %s, want %s", current.CurrentMessageId, tt.wantLeaf)
+			}
+		})
+	}
+
+	for _, id := range []string{"x", "y", "z", "gone"} {
+		if _, err := messages.SwitchActiveBranch("u", "s", id); !errors.Is(err, constant.ErrInvalidMessageID) {
+			t.Errorf("SwitchActiveBranch(%s): err = %v, want ErrInvalidMessageID", id, err)
+		}
+	}
+	if _, err := messages.SwitchActiveBranch("other", "s", "a1"); err == nil {
+		t.Error("SwitchActiveBranch by another user: want error")
+	}
+}
+
+// renderTree 把消息树写成 "id(子节点…)" 的形式，超出深度时写成 "id[子消息数]"
+func renderTree(nodes []*response.MessageTreeNode) string {
+	parts := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		switch {
+		case len(node.Children) > 0:
+			parts = append(parts, node.ID+"("+renderTree(node.Children)+")")
+		case node.ChildCount > 0:
+			parts = append(parts, fmt.Sprintf("%s[%d]", node.ID, node.ChildCount))
+		default:
+			parts = append(parts, node.ID)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestGetMessageTree(t *testing.T) {
+	messages := newBranchTestService(t)
+	tests := []struct {
+		name string
+		opts MessageTreeOptions
+		want string
+	}{
+		{"whole tree", MessageTreeOptions{}, "u1(a1 a1b(u2(a2 a2b))) u1b(a1c)"},
+		{"depth 1", MessageTreeOptions{MaxDepth: 1}, "u1[2] u1b[1]"},
+		{"depth 3", MessageTreeOptions{MaxDepth: 3}, "u1(a1 a1b(u2[2])) u1b(a1c)"},
+		{"depth beyond the tree", MessageTreeOptions{MaxDepth: 10}, "u1(a1 a1b(u2(a2 a2b))) u1b(a1c)"},
+		{"subtree", MessageTreeOptions{RootID: "u2"}, "u2(a2 a2b)"},
+		{"subtree with depth", MessageTreeOptions{RootID: "a1b", MaxDepth: 2}, "a1b(u2[2])"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := messages.GetMessageTree("u", "s", tt.opts)
+			if err != nil {
+				t.Fatalf("GetMessageTree: %v", err)
+			}
+			if got := renderTree(tree.Roots); got != tt.want {
+				t.Errorf("tree = %s, want %s", got, tt.want)
+			}
+			// 总数和激活叶子不受裁剪影响
+			if tree.TotalCount != 8 || tree.ActiveLeafID != "a1c" {
+				t.Errorf("total %d, active leaf %s, want 8 and a1c", tree.TotalCount, tree.ActiveLeafID)
+			}
+		})
+	}
+
+	for _, id := range []string{"x", "gone"} {
+		if _, err := messages.GetMessageTree("u", "s", MessageTreeOptions{RootID: id}); !errors.Is(err, constant.ErrInvalidMessageID) {
+			t.Errorf("GetMessageTree(root %s): err = %v, want ErrInvalidMessageID", id, err)
+		}
+	}
+	if _, err := messages.GetMessageTree("other", "s", MessageTreeOptions{}); err == nil {
+		t.Error("GetMessageTree by another user: want error")
+	}
+}
+
+func TestGetMessageTreeContentLimit(t *testing.T) {
+	messages := newBranchTestService(t)
+	if err := messages.db.Model(&models.Message{ID: "u1b"}).Update("content", "你好世界").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		limit         int
+		wantContent   string
+		wantTruncated bool
+	}{
+		{0, "你好世界", false},
+		{-1, "你好世界", false},
+		// 按字符截断，不会截断到多字节字符中间
+		{2, "你好", true},
+		{4, "你好世界", false},
+		{10, "你好世界", false},
+	}
+	for _, tt := range tests {
+		tree, err := messages.GetMessageTree("u", "s", MessageTreeOptions{RootID: "u1b", ContentLimit: tt.limit})
+		if err != nil {
+			t.Fatalf("GetMessageTree: %v", err)
+		}
+		root := tree.Roots[0]
+		if root.Content != tt.wantContent || root.Truncated != tt.wantTruncated {
+			t.Errorf("limit %d: content %q truncated %v, want %q %v", tt.limit, root.Content, root.Truncated, tt.wantContent, tt.wantTruncated)
+		}
+		// 子节点同样截断
+		if child := root.Children[0]; tt.limit == 2 && (child.Content != "co" || !child.Truncated) {
+			t.Errorf("limit %d: child content %q truncated %v", tt.limit, child.Content, child.Truncated)
+		}
+	}
+}
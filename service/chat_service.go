@@ -6,34 +6,75 @@ import (
 	"net/http"
 	constant "session-management/const"
 	"session-management/models"
+	"session-management/pkg/streambus"
+	"session-management/pkg/tokenizer"
 	"session-management/requests"
 	"session-management/response"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/emicklei/go-restful/v3"
 	"github.com/google/uuid"
 )
 
+// ChatService 对话服务：保存消息、启动生成并推送流
+type ChatService struct {
+	projects   *ProjectService
+	sessions   *SessionService
+	messages   *MessageService
+	streams    *StreamManager
+	providers  *ProviderRegistry   // 按项目配置选择模型提供方
+	tokenizers *tokenizer.Registry // 统计消息和 prompt 的 token 数
+}
+
+// 创建对话服务
+func NewChatService(projects *ProjectService, sessions *SessionService, messages *MessageService, streams *StreamManager,
+	providers *ProviderRegistry, tokenizers *tokenizer.Registry) *ChatService {
+	return &ChatService{
+		projects:   projects,
+		sessions:   sessions,
+		messages:   messages,
+		streams:    streams,
+		providers:  providers,
+		tokenizers: tokenizers,
+	}
+}
+
 // 在已有会话中新对话
-func NewStreamChatInSession(streamChatDto models.StreamChatDto) error {
+func (s *ChatService) NewStreamChatInSession(streamChatDto models.StreamChatDto) error {
+	sse, err := newSSEResponse(streamChatDto.Req, streamChatDto.Resp)
+	if err != nil {
+		return err
+	}
+	stream, err := s.StartStreamChatInSession(streamChatDto)
+	if err != nil {
+		return err
+	}
+	return s.streams.dealStreamResponse(stream, fromChunkLatest, sse)
+}
+
+// StartStreamChatInSession 保存用户消息并启动生成，返回生成中的流，由调用方选择推送方式
+func (s *ChatService) StartStreamChatInSession(streamChatDto models.StreamChatDto) (*StreamState, error) {
+	if err := s.streams.checkAcceptingChats(); err != nil {
+		return nil, err
+	}
 
 	//检查session 有效性
-	session, err := GetSessionById(streamChatDto.UserId, streamChatDto.SessionId)
+	session, err := s.sessions.GetSessionById(streamChatDto.UserId, streamChatDto.SessionId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	//检查project 有效性
 	if session.ProjectID != streamChatDto.ProjectID {
-		return &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "项目ID不匹配"}
+		return nil, &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "项目ID不匹配"}
 	}
 
 	//检查lastMessageId 有效性
 	if streamChatDto.LastMsgID != "" {
-		_, err := GetMessageById(streamChatDto.SessionId, streamChatDto.LastMsgID)
+		_, err := s.messages.GetMessageById(streamChatDto.SessionId, streamChatDto.LastMsgID)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -53,7 +94,7 @@ func NewStreamChatInSession(streamChatDto models.StreamChatDto) error {
 		Steps:      nil,
 		Files:      streamChatDto.Files,
 		Content:    streamChatDto.Query,
-		TokenCount: len(streamChatDto.Query),
+		TokenCount: countTokens(s.tokenizers, "", streamChatDto.Query),
 
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -64,17 +105,132 @@ func NewStreamChatInSession(streamChatDto models.StreamChatDto) error {
 		Metadata:  nil,
 	}
 
-	if err := CreateAndSaveMessage(userMsg); err != nil {
-		return err
+	if err := s.messages.CreateAndSaveMessage(userMsg); err != nil {
+		return nil, err
 	}
 	log.Printf("保存用户消息成功 userMsgId=%s", userMsgId)
 
+	return s.startAssistantStream(streamChatDto.UserId, userMsg, nil)
+}
+
+// RegenerateStreamChat 重新生成回答
+// messageID 可以是要重新生成的助手消息，也可以是它的父用户消息；
+// 新回答作为同一用户消息下的兄弟节点，旧回答保留为其他版本
+func (s *ChatService) RegenerateStreamChat(userId, sessionID, messageID string, req *restful.Request, resp *restful.Response) error {
+	sse, err := newSSEResponse(req, resp)
+	if err != nil {
+		return err
+	}
+	stream, err := s.StartRegenerate(userId, sessionID, messageID)
+	if err != nil {
+		return err
+	}
+	return s.streams.dealStreamResponse(stream, fromChunkLatest, sse)
+}
+
+// StartRegenerate 校验要重新生成的消息并启动生成，返回生成中的流
+func (s *ChatService) StartRegenerate(userId, sessionID, messageID string) (*StreamState, error) {
+	if err := s.streams.checkAcceptingChats(); err != nil {
+		return nil, err
+	}
+	// 验证会话归属
+	if _, err := s.sessions.GetSessionById(userId, sessionID); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.messages.GetMessageById(sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Deleted {
+		return nil, constant.ErrInvalidMessageID
+	}
+
+	// 找到父用户消息
+	userMsg := msg
+	if msg.Role == constant.RoleAssistant {
+		if msg.ParentID == nil {
+			return nil, constant.ErrInvalidMessageID
+		}
+		if userMsg, err = s.messages.GetMessageById(sessionID, *msg.ParentID); err != nil {
+			return nil, err
+		}
+	}
+	if userMsg.Role != constant.RoleUser || userMsg.Deleted {
+		return nil, constant.ErrInvalidMessageID
+	}
+
+	return s.startAssistantStream(userId, userMsg, models.JSONMap{"regenerated_from": messageID})
+}
+
+// EditAndResendStreamChat 编辑用户消息并重发
+// 编辑后的问题作为原消息的兄弟分支（继承原 parent），原分支保留
+func (s *ChatService) EditAndResendStreamChat(userId, sessionID, messageID string, reqBody *requests.EditMessageReq, req *restful.Request, resp *restful.Response) error {
+	sse, err := newSSEResponse(req, resp)
+	if err != nil {
+		return err
+	}
+	stream, err := s.StartEditAndResend(userId, sessionID, messageID, reqBody)
+	if err != nil {
+		return err
+	}
+	return s.streams.dealStreamResponse(stream, fromChunkLatest, sse)
+}
+
+// StartEditAndResend 保存编辑后的用户消息并启动生成，返回生成中的流
+func (s *ChatService) StartEditAndResend(userId, sessionID, messageID string, reqBody *requests.EditMessageReq) (*StreamState, error) {
+	if err := s.streams.checkAcceptingChats(); err != nil {
+		return nil, err
+	}
+	// 验证会话归属
+	if _, err := s.sessions.GetSessionById(userId, sessionID); err != nil {
+		return nil, err
+	}
+	if reqBody.Query == "" {
+		return nil, &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "问题不能为空"}
+	}
+
+	targetMsg, err := s.messages.GetMessageById(sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if targetMsg.Role != constant.RoleUser || targetMsg.Deleted {
+		return nil, constant.ErrInvalidMessageID
+	}
+
+	//保存编辑后的用户消息
+	userMsg := &models.Message{
+		ID:        uuid.NewString(),
+		SessionID: sessionID,
+		ParentID:  targetMsg.ParentID,
+
+		Role:       constant.RoleUser,
+		Files:      reqBody.Files,
+		Content:    reqBody.Query,
+		TokenCount: countTokens(s.tokenizers, "", reqBody.Query),
+
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Status:    constant.MessageStatusCompleted,
+
+		Metadata: models.JSONMap{"edited_from": messageID},
+	}
+	if err := s.messages.CreateAndSaveMessage(userMsg); err != nil {
+		return nil, err
+	}
+	log.Printf("保存编辑后的用户消息成功 userMsgId=%s, editedFrom=%s", userMsg.ID, messageID)
+
+	return s.startAssistantStream(userId, userMsg, nil)
+}
+
+// startAssistantStream 在用户消息下创建助手消息占位并启动生成
+func (s *ChatService) startAssistantStream(userId string, userMsg *models.Message, metadata models.JSONMap) (*StreamState, error) {
 	assistantMsgId := uuid.NewString()
 	//保存助手消息占位,标识processing
 	assistantMsg := &models.Message{
 		ID:        assistantMsgId,
-		SessionID: streamChatDto.SessionId,
-		ParentID:  &userMsgId,
+		SessionID: userMsg.SessionID,
+		ParentID:  &userMsg.ID,
 
 		Role:       constant.RoleAssistant,
 		Steps:      nil,
@@ -88,73 +244,85 @@ func NewStreamChatInSession(streamChatDto models.StreamChatDto) error {
 		Deleted:   false,
 
 		Extension: nil,
-		Metadata:  nil,
+		Metadata:  metadata,
 	}
-	if err := CreateAndSaveMessage(assistantMsg); err != nil {
-		return err
+	if err := s.messages.CreateAndSaveMessage(assistantMsg); err != nil {
+		return nil, err
 	}
 	log.Printf("保存助手消息占位成功 assistantMsgId=%s", assistantMsgId)
 
+	// 新回答所在分支成为激活分支
+	if err := s.messages.setActiveLeaf(userMsg.SessionID, assistantMsgId); err != nil {
+		log.Printf("setActiveLeaf failed: %v", err)
+	}
+
 	//获取流
-	stream := GlobalStreamManager.GetOrCreateStream(streamChatDto.SessionId, assistantMsgId, userMsgId, streamChatDto.Query, false)
+	stream := s.streams.GetOrCreateStream(userMsg.SessionID, assistantMsgId, userMsg.ID, userMsg.Content, false)
 	if stream == nil {
-		return &response.BizError{HttpStatus: http.StatusInternalServerError, Code: 500, Msg: "无法创建流状态"}
+		return nil, &response.BizError{HttpStatus: http.StatusInternalServerError, Code: 500, Msg: "无法创建流状态"}
 	}
+	stream.Metadata = metadata
+	s.streams.publishStreamOpen(stream)
 
 	// 启动流式对话处理
-	go StreamChatStarter(streamChatDto.UserId, stream, streamChatDto.LastMsgID, streamChatDto.Query, streamChatDto.SessionId, streamChatDto.Resp)
+	go s.StreamChatStarter(userId, stream)
 
-	return dealStreamResponse(stream, false, streamChatDto.Req, streamChatDto.Resp)
+	return stream, nil
 }
 
-// StreamChatStarter 启动流式对话处理
-func StreamChatStarter(userId string, stream *StreamState, tailMsgId string, query string, sessionID string, resp *restful.Response) {
-
-	// 构造最终prompt
-	prompt := buildFinalPrompt(userId, tailMsgId, sessionID, query)
-	_ = prompt
-	log.Println("Final Prompt:", prompt)
-
-	// 调用模型层处理流式对话
-	// stream := my_models.StreamChat(reqBody)
-
-	streamChatInner(stream, prompt, sessionID)
+// StreamChatStarter 启动流式对话处理，以流的父用户消息作为最后一轮
+func (s *ChatService) StreamChatStarter(userId string, stream *StreamState) {
 
-}
-
-// buildFinalPrompt 构建最终prompt
-func buildFinalPrompt(userId string, tailMsgId string, sessionID string, query string) string {
-	//构造历史上下文
-	history := buildHistoryContext(sessionID, tailMsgId)
+	// 构造结构化prompt
+	builder, err := s.NewPromptBuilder(stream.Context(), userId, stream.SessionID)
+	if err != nil {
+		log.Printf("NewPromptBuilder failed: %v", err)
+		s.streams.breakLocal(stream.Key(), BreakReasonError)
+		return
+	}
+	messages, err := builder.BuildUntil(*stream.ParentID)
+	if err != nil {
+		log.Printf("BuildUntil failed: %v", err)
+		s.streams.breakLocal(stream.Key(), BreakReasonError)
+		return
+	}
+	log.Printf("Final Prompt: %d messages", len(messages))
+	if stream.Context().Err() != nil {
+		// 组装 prompt（如生成摘要）期间流已被中断并入库
+		log.Printf("stream %s broken while building prompt", stream.Key())
+		return
+	}
 
-	//查询session
-	session, err := GetSessionById(userId, sessionID)
+	// 根据项目的模型服务配置选择提供方
+	modelCfg := builder.ModelConfig()
+	provider, err := s.providers.ForConfig(modelCfg)
 	if err != nil {
-		return ""
+		log.Printf("select provider failed: %v", err)
+		s.streams.breakLocal(stream.Key(), BreakReasonError)
+		return
 	}
 
-	//获取项目级别的prompt模板
-	var customInstruction = ""
-	if session.ProjectID != "" {
-		project, err := GetProjectById(userId, session.ProjectID)
-		if err == nil {
-			customInstruction = project.CustomInstruction
-		}
+	stream.Mu.Lock()
+	stream.PromptTokens = countPromptTokens(s.tokenizers, jsonMapString(modelCfg, ModelCfgModel), messages)
+	stream.IdleTimeout = s.streams.idleTimeoutFor(modelCfg)
+	stream.Mu.Unlock()
+
+	chatReq := &ChatRequest{
+		Messages: messages,
+		Config:   modelCfg,
 	}
+	s.streamChatInner(stream, provider, chatReq)
 
-	// 合并历史上下文和当前查询
-	finalPrompt := "系统指令:\n" + customInstruction + "\n\n对话历史:\n" + history + "\n\n当前问题:\n" + query
-	return finalPrompt
 }
 
-// buildHistoryContext 构建历史上下文, 从lastMsgID开始, 直到根消息
-func buildHistoryContext(sessionID string, tailMsgId string) string {
+// buildHistoryContext 构建历史上下文, 从tailMsgId开始回溯到根消息, 返回 root → tail 的路径
+func (s *MessageService) buildHistoryContext(sessionID string, tailMsgId string) []models.Message {
 	if tailMsgId == "" {
-		return ""
+		return nil
 	}
 	// 从数据库查询历史消息
 	var messages []models.Message
-	Dbservice.DB.Where("session_id = ? AND deleted = ?", sessionID, false).Find(&messages)
+	s.db.Where("session_id = ? AND deleted = ?", sessionID, false).Find(&messages)
 
 	msgMap := make(map[string]models.Message)
 	for _, msg := range messages {
@@ -174,185 +342,159 @@ func buildHistoryContext(sessionID string, tailMsgId string) string {
 		messageId = msg.ParentID
 	}
 	// 反转切片顺序
-	var historyContext strings.Builder
-	for i := len(historyMsgs) - 1; i >= 0; i-- {
-		msg := historyMsgs[i]
-		historyContext.WriteString(msg.Role + ": " + msg.Content + "\n")
+	for i, j := 0, len(historyMsgs)-1; i < j; i, j = i+1, j-1 {
+		historyMsgs[i], historyMsgs[j] = historyMsgs[j], historyMsgs[i]
 	}
 
-	return historyContext.String()
+	return historyMsgs
 }
 
-func streamChatInner(stream *StreamState, prompt string, sessionID string) {
-	// 调用模型层处理流式对话
-	// stream := my_models.StreamChat(prompt)
-
-	// 5. 模拟 AI 流式回复
-	reply := `现在时间是` + time.Now().Format("2006-01-02 15:04:05") + `，春江潮水连海平，海上明月共潮生①。
-	滟滟随波千万里②，何处春江无月明！
-	江流宛转绕芳甸③，月照花林皆似霰④。
-	空里流霜不觉飞⑤，汀上白沙看不见⑥。
-	江天一色无纤尘⑦，皎皎空中孤月轮⑧。
-	江畔何人初见月？江月何年初照人？`
-
-	for i, ch := range reply {
+// streamChatInner 调用模型提供方，把增量内容写入流并广播给客户端
+func (s *ChatService) streamChatInner(stream *StreamState, provider Provider, chatReq *ChatRequest) {
+	streamKey := stream.SessionID + "_" + stream.MessageID
+	stream.Mu.Lock()
+	stream.Model = provider.Name()
+	stream.Mu.Unlock()
+
+	// 超过空闲时间没有新chunk（模型或工具调用卡住）时中断
+	stream.Mu.RLock()
+	idleTimeout := stream.IdleTimeout
+	stream.Mu.RUnlock()
+	if idleTimeout <= 0 {
+		idleTimeout = s.streams.cfg.IdleTimeout
+	}
+	idle := time.AfterFunc(idleTimeout, func() {
+		log.Printf("stream %s idle for %s, breaking", streamKey, idleTimeout)
+		s.streams.breakLocal(streamKey, BreakReasonIdle)
+	})
+	defer idle.Stop()
 
-		content := string(ch)
+	ctx := stream.Context()
+	result, err := provider.StreamChat(ctx, chatReq, func(delta string) error {
 		stream.Mu.Lock()
-		stream.Chunks = append(stream.Chunks, content)
+		// 流已中断：不再追加chunk，返回错误让提供方停止读取上游
+		if stream.IsBreak || stream.IsCompleted {
+			stream.Mu.Unlock()
+			return context.Canceled
+		}
+		chunkID := len(stream.Chunks)
+		stream.Chunks = append(stream.Chunks, delta)
 		stream.UpdatedAt = time.Now()
-		stream.FullResponse += content
+		stream.FullResponse += delta
+		// chunk日志批量写入，在 stream.Mu 内加入缓存，流结束时剩余部分一定会写入
+		flush := stream.chunkLog.add(chunkID, delta)
 		stream.Mu.Unlock()
 
-		chunk := StreamChunk{
-			ChunkID: i,
-			Content: string(ch),
+		idle.Reset(idleTimeout)
+		// 先通知本实例的客户端，推送不等待数据库和总线
+		notifyClients(stream)
+		if s.streams.busChunks {
+			s.streams.publishStreamEvent(stream, streambus.Event{Type: streambus.EventChunk, ChunkID: chunkID, Content: delta})
 		}
-		broadcastChunk(stream, chunk)
-		time.Sleep(50 * time.Millisecond)
+		if flush {
+			stream.chunkLog.flush()
+		}
+		return nil
+	})
+	if ctx.Err() != nil {
+		// 已由 BreakStream 取消并入库，这里不再重复处理
+		log.Printf("provider %s stream canceled for key %s", provider.Name(), streamKey)
+		return
+	}
+	if err != nil {
+		log.Printf("provider %s stream failed for key %s: %v", provider.Name(), streamKey, err)
+		s.streams.breakLocal(streamKey, BreakReasonError)
+		return
 	}
-	GlobalStreamManager.CompleteStream(stream.SessionID + "_" + stream.MessageID)
-	// 6. 结束标记
-	log.Println("Completed StreamChatService for key:", stream.SessionID+"_"+stream.MessageID)
 
-}
-func broadcastChunk(stream *StreamState, chunk StreamChunk) {
-	stream.Mu.RLock() // 只需要读锁
-	defer stream.Mu.RUnlock()
-
-	for _, clientChan := range stream.Clients {
-		select {
-		case clientChan <- chunk: // 只读取map，不修改它
-			// 发送成功
-		default:
-			log.Println("Client channel is full, skipping chunk:", chunk)
-			// 客户端可能已断开，跳过
-			// 即使这里发现客户端有问题，也不立即删除
-			// 可以标记或异步处理
+	// 记录模型和用量，CompleteStream 入库时写入消息
+	stream.Mu.Lock()
+	if result != nil {
+		if result.Model != "" {
+			stream.Model = result.Model
 		}
+		stream.Usage = result.Usage
 	}
+	stream.Mu.Unlock()
+
+	s.streams.CompleteStream(streamKey)
+	// 6. 结束标记
+	log.Println("Completed StreamChatService for key:", streamKey)
+
 }
 
-// dealStreamResponse 处理流式响应
-func dealStreamResponse(stream *StreamState, resume bool, req *restful.Request, resp *restful.Response) error {
-	// 获取客户端ID，每次请求都生成一个新的ID，防止多个客户端用同一个id同时请求导致数据混乱
-	clientID := uuid.NewString()
-
-	// 1. 设置 SSE Header
-	writer := resp.ResponseWriter
-	writer.Header().Set("Content-Type", "text/event-stream")
-	writer.Header().Set("Cache-Control", "no-cache")
-	writer.Header().Set("Connection", "keep-alive")
-	resp.Header().Set("Access-Control-Allow-Origin", "*")
-
-	flusher, ok := writer.(http.Flusher)
-	if !ok {
-		// http.Error(writer, "Streaming unsupported", http.StatusInternalServerError)
-		return &response.BizError{
-			HttpStatus: http.StatusInternalServerError,
-			Code:       500,
-			Msg:        "Streaming unsupported",
+// 恢复流式对话
+func (s *ChatService) ResumeStreamChat(userId, sessionID string, reqBody *requests.ResumeStreamChatReq, req *restful.Request, resp *restful.Response) error {
+	log.Println("ResumeStreamChat reqBody:", reqBody)
+
+	// 续传起点：优先使用请求体中的 from_chunk，其次是 SSE 标准的 Last-Event-ID（最后收到的chunk序号）
+	fromChunk := fromChunkLatest
+	if reqBody.FromChunk != nil {
+		if *reqBody.FromChunk < 0 {
+			return &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "from_chunk不能为负数"}
 		}
+		fromChunk = *reqBody.FromChunk
+	} else if lastEventID := req.HeaderParameter("Last-Event-ID"); lastEventID != "" {
+		lastChunkID, err := strconv.Atoi(lastEventID)
+		if err != nil || lastChunkID < 0 {
+			return &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "Last-Event-ID无效"}
+		}
+		fromChunk = lastChunkID + 1
 	}
 
-	// 8. 发送连接成功事件
-	// 告知客户端连接已建立，并返回会话和消息ID信息
-	// is_resume 字段指示当前是否为续传模式
-	SendSSE(writer, flusher, "connected", map[string]any{
-		"message_id": stream.MessageID,
-		"session_id": stream.SessionID,
-		"history":    stream.FullResponse,
-	})
-	// 7. 注册客户端接收通道
-	// 将当前连接注册到流管理器中，以便接收广播消息
-	// 返回一个只读通道 chunkChan，用于接收 StreamChunk
-	chunkChan := GlobalStreamManager.RegisterClient(stream, clientID)
-	if chunkChan == nil {
-		// resp.WriteError(http.StatusInternalServerError, errors.New("无法注册客户端"))
-		return &response.BizError{
-			HttpStatus: http.StatusInternalServerError,
-			Code:       500,
-			Msg:        "无法注册客户端",
-		}
+	sse, err := newSSEResponse(req, resp)
+	if err != nil {
+		return err
 	}
-	// 10. 监听消息并推送
-	// 创建一个带有取消功能的上下文，用于监听客户端断开连接
-	ctx, cancel := context.WithTimeout(req.Request.Context(), 30*time.Minute)
-	defer cancel()
-	for {
-		select {
-		// 监听来自 streamManager 的消息通道
-		case chunk, ok := <-chunkChan:
-			if !ok {
-				// 添加错误日志
-				log.Printf("chunkChan closed for client %s, message %s",
-					clientID, stream.MessageID)
-				// 通道关闭，通常意味着流被管理器强制关闭或发生错误
-				SendSSE(writer, flusher, "complete", map[string]any{
-					"message_id":      stream.MessageID,
-					"session_id":      stream.SessionID,
-					"partial_content": stream.FullResponse,
-				})
-				log.Println("deal stream chat:  !ok  :", stream.MessageID)
-				return nil
-			}
-
-			// 处理结束标志
-			if chunk.IsCompleted || chunk.IsBreak {
-				SendSSE(writer, flusher, "complete", map[string]any{
-					"message_id":   stream.MessageID,
-					"session_id":   stream.SessionID,
-					"full_content": stream.FullResponse,
-					"is_final":     stream.IsCompleted,
-					"is_break":     stream.IsBreak,
-				})
-				return nil
-			}
-
-			// 发送普通的数据分块 (chunk)
-			SendSSE(writer, flusher, "chunk", map[string]any{
-				"session_id": stream.SessionID,
-				"message_id": stream.MessageID,
-				"chunk_id":   chunk.ChunkID,
-				"content":    chunk.Content,
-				"is_final":   false,
-			})
-
-		// 监听客户端连接状态
-		case <-ctx.Done():
-			// 客户端断开连接（如关闭浏览器标签页）
-			// 循环退出，触发 defer streamManager.UnregisterClient
-			log.Println("deal stream chat:  <-ctx.Done()  :", clientID)
-			return nil
-		}
+	stream, err := s.OpenResumeStream(userId, sessionID, reqBody.MessageID)
+	if err != nil {
+		return err
 	}
+	return s.streams.dealStreamResponse(stream, fromChunk, sse)
+
 }
 
-// 恢复流式对话
-func ResumeStreamChat(userId, sessionID string, reqBody *requests.ResumeStreamChatReq, req *restful.Request, resp *restful.Response) error {
-	log.Println("ResumeStreamChat reqBody:", reqBody)
+// OpenResumeStream 查找要续传的流：本实例生成中的流、其它实例上生成的流的镜像，
+// 或者从持久化的chunk日志重建的已结束的流
+func (s *ChatService) OpenResumeStream(userId, sessionID, messageID string) (*StreamState, error) {
 	// 验证会话归属
-	if _, err := QuerySession(userId, sessionID); err != nil {
-		return err
+	if _, err := s.sessions.QuerySession(userId, sessionID); err != nil {
+		return nil, err
 	}
 
 	// 获取或创建流状态
-	stream := GlobalStreamManager.GetOrCreateStream(sessionID, reqBody.MessageID, "", "", true)
+	stream := s.streams.GetOrCreateStream(sessionID, messageID, "", "", true)
 	if stream == nil {
-		return &response.BizError{
-			HttpStatus: http.StatusNotFound,
-			Code:       404,
-			Msg:        "流不存在",
-		}
+		// 生成在其它实例上，建立镜像流
+		stream = s.streams.attachRemoteStream(sessionID, messageID)
 	}
-	return dealStreamResponse(stream, true, req, resp)
+	if stream == nil {
+		// 没有实例在生成该流（已结束或服务重启），从持久化的chunk日志重放
+		return s.messages.loadStreamFromLog(sessionID, messageID)
+	}
+	return stream, nil
+}
 
+// ListSessionStreams 查询会话正在进行的流式生成
+func (s *ChatService) ListSessionStreams(userID, sessionID string) (*response.ListStreamsResponse, error) {
+	if _, err := s.sessions.GetSessionById(userID, sessionID); err != nil {
+		return nil, err
+	}
+	streams := s.streams.ListStreams(sessionID)
+	return &response.ListStreamsResponse{Count: len(streams), Streams: streams}, nil
 }
 
 // CreateSessionAndChat 创建会话并开始对话
-func CreateSessionAndChat(userId string, reqBody *requests.CreateSessionAndChatReq, req *restful.Request, resp *restful.Response) error {
+func (s *ChatService) CreateSessionAndChat(userId string, reqBody *requests.CreateSessionAndChatReq, req *restful.Request, resp *restful.Response) error {
+	if err := s.streams.checkAcceptingChats(); err != nil {
+		return err
+	}
+	// 推送参数有误时不创建会话
+	if _, err := newSSEResponse(req, resp); err != nil {
+		return err
+	}
 	// 1. 创建会话
-	session, err := CreateSession(userId, reqBody.ProjectID, genTitleFromQuery(reqBody.Query))
+	session, err := s.sessions.CreateSession(userId, reqBody.ProjectID, genTitleFromQuery(reqBody.Query))
 	if err != nil {
 		return err
 	}
@@ -369,6 +511,6 @@ func CreateSessionAndChat(userId string, reqBody *requests.CreateSessionAndChatR
 	}
 
 	// 2. 对话
-	return NewStreamChatInSession(streamChatDto)
+	return s.NewStreamChatInSession(streamChatDto)
 
 }
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/pkg/streambus"
+	"session-management/pkg/tokenizer"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB 打开临时 SQLite 库并迁移给定的表
+func openTestDB(t *testing.T, tables ...any) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// newTestChatService 在临时 SQLite 库上构造对话服务，并创建一条生成中的助手消息 s/m
+func newTestChatService(t *testing.T) (*ChatService, *MessageService) {
+	t.Helper()
+	db := openTestDB(t, &models.Message{}, &models.StreamChunkLog{})
+	now := time.Now()
+	err := db.Create(&models.Message{
+		ID:        "m",
+		SessionID: "s",
+		Role:      constant.RoleAssistant,
+		Status:    constant.MessageStatusProcessing,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}).Error
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	messages := NewMessageService(db, nil)
+	streams := NewStreamManager(messages, nil, nil, testStreamConfig(), "test")
+	return NewChatService(nil, nil, messages, streams, NewProviderRegistry(), tokenizer.NewRegistry(nil)), messages
+}
+
+// startDelivery 在后台把流推送到 sink，等到 connected 事件发出后返回
+func startDelivery(t *testing.T, sm *StreamManager, stream *StreamState, sink *recordingSink) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- sm.deliverStream(context.Background(), stream, fromChunkLatest, FlushPolicy{}, sink) }()
+	waitFor(t, func() bool { return len(sink.names()) > 0 })
+	return done
+}
+
+func userRequest(content string) *ChatRequest {
+	return &ChatRequest{Messages: []ChatMessage{{Role: constant.RoleUser, Content: content}}}
+}
+
+func TestStreamChatComplete(t *testing.T) {
+	chat, messages := newTestChatService(t)
+	sm := chat.streams
+	stream := sm.GetOrCreateStream("s", "m", "u", "hello", false)
+
+	sink := &recordingSink{}
+	done := startDelivery(t, sm, stream, sink)
+	chat.streamChatInner(stream, NewEchoProvider(), userRequest("hello"))
+	if err := <-done; err != nil {
+		t.Fatalf("deliverStream: %v", err)
+	}
+
+	if got := strings.Join(sink.names(), " "); got != "connected chunk complete" {
+		t.Fatalf("events = %s, want connected chunk complete", got)
+	}
+	if got := sink.content(); got != "hello" {
+		t.Errorf("chunk content = %q, want hello", got)
+	}
+	last := sink.events[len(sink.events)-1].data
+	if last["full_content"] != "hello" || last["is_final"] != true || last["is_break"] != false {
+		t.Errorf("complete event = %v", last)
+	}
+
+	msg, err := messages.GetMessageById("s", "m")
+	if err != nil {
+		t.Fatalf("GetMessageById: %v", err)
+	}
+	if msg.Content != "hello" || msg.Status != constant.MessageStatusCompleted || msg.Metadata["model"] != "echo" {
+		t.Errorf("persisted message = %q, %s, %v", msg.Content, msg.Status, msg.Metadata)
+	}
+	logs, err := messages.loadChunkLogs("s", "m")
+	if err != nil || len(logs) != len("hello") {
+		t.Errorf("chunk logs = %d, %v; want %d", len(logs), err, len("hello"))
+	}
+}
+
+func TestStreamChatBreak(t *testing.T) {
+	chat, messages := newTestChatService(t)
+	sm := chat.streams
+	stream := sm.GetOrCreateStream("s", "m", "u", "q", false)
+	script := strings.Repeat("x", 1000)
+	provider := &ScriptedProvider{
+		ProviderName: "slow",
+		Delay:        5 * time.Millisecond,
+		Script:       func(req *ChatRequest) string { return script },
+	}
+
+	sink := &recordingSink{}
+	done := startDelivery(t, sm, stream, sink)
+	generated := make(chan struct{})
+	go func() {
+		chat.streamChatInner(stream, provider, userRequest("q"))
+		close(generated)
+	}()
+
+	waitFor(t, func() bool { return sink.content() != "" })
+	if ok, err := sm.BreakStream("s", "m"); !ok || err != nil {
+		t.Fatalf("BreakStream = %v, %v", ok, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("deliverStream: %v", err)
+	}
+	<-generated
+
+	if got := strings.Join(sink.names(), " "); got != "connected chunk complete" {
+		t.Fatalf("events = %s, want connected chunk complete", got)
+	}
+	last := sink.events[len(sink.events)-1].data
+	if last["is_final"] != false || last["is_break"] != true {
+		t.Errorf("complete event = %v, want is_break", last)
+	}
+	content := sink.content()
+	if content == script || last["full_content"] != content {
+		t.Errorf("delivered %d chars, full_content %d chars, script %d chars",
+			len(content), len(last["full_content"].(string)), len(script))
+	}
+
+	msg, err := messages.GetMessageById("s", "m")
+	if err != nil {
+		t.Fatalf("GetMessageById: %v", err)
+	}
+	if msg.Content != content || msg.Status != constant.MessageStatusInterrupted || msg.Metadata["break_reason"] != BreakReasonUser {
+		t.Errorf("persisted message = %d chars, %s, %v", len(msg.Content), msg.Status, msg.Metadata)
+	}
+
+	// 中断后不能再中断
+	if ok, _ := sm.BreakStream("s", "m"); ok {
+		t.Error("second BreakStream succeeded")
+	}
+}
+
+func TestStreamChatSkipsChunkEventsInProcess(t *testing.T) {
+	chat, _ := newTestChatService(t)
+	sm := chat.streams
+	stream := sm.GetOrCreateStream("s", "m", "u", "hello", false)
+	sm.publishStreamOpen(stream)
+	events, err := sm.bus.Subscribe(context.Background(), stream.Key(), "0")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	// 进程内总线没有镜像流，只发布结束事件
+	chat.streamChatInner(stream, NewEchoProvider(), userRequest("hello"))
+	var types []streambus.EventType
+	for ev := range events {
+		types = append(types, ev.Type)
+	}
+	if len(types) != 1 || types[0] != streambus.EventComplete {
+		t.Errorf("bus events = %v, want only %s", types, streambus.EventComplete)
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"session-management/config"
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/response"
+	"strings"
+	"sync"
+	"time"
+)
+
+// appendChunkLogs 批量写入chunk日志
+func (s *MessageService) appendChunkLogs(records []models.StreamChunkLog) error {
+	return s.db.CreateInBatches(records, 200).Error
+}
+
+// chunkLogWriter 批量写入一个流的chunk日志，生成回调只把chunk放入缓存，不等待数据库
+// 第一个缓存的chunk到期或缓存达到 FlushBytes 时写入，流结束时由 close 写入剩余部分
+type chunkLogWriter struct {
+	messages  *MessageService
+	sessionID string
+	messageID string
+	cfg       config.ChunkLogConfig
+
+	mu      sync.Mutex // 保护以下缓存字段
+	pending []models.StreamChunkLog
+	bytes   int
+	timer   *time.Timer
+	closed  bool
+
+	writeMu sync.Mutex // 串行写入，close 返回时之前的批次都已写完
+}
+
+// newChunkLogWriter 创建流的chunk日志写入器，没有消息服务（只推送不入库）时返回 nil
+func (sm *StreamManager) newChunkLogWriter(sessionID, messageID string) *chunkLogWriter {
+	if sm.messages == nil {
+		return nil
+	}
+	return &chunkLogWriter{
+		messages:  sm.messages,
+		sessionID: sessionID,
+		messageID: messageID,
+		cfg:       sm.cfg.ChunkLog,
+	}
+}
+
+// add 缓存一个chunk，返回是否需要立即写入；调用方持有 stream.Mu，保证流结束后不会再有chunk加入
+func (w *chunkLogWriter) add(chunkID int, content string) bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false
+	}
+	w.pending = append(w.pending, models.StreamChunkLog{
+		SessionID: w.sessionID,
+		MessageID: w.messageID,
+		ChunkID:   chunkID,
+		Content:   content,
+		CreatedAt: time.Now(),
+	})
+	w.bytes += len(content)
+	if w.bytes >= w.cfg.FlushBytes {
+		return true
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.cfg.FlushInterval, w.flush)
+	}
+	return false
+}
+
+// flush 写入缓存的chunk，失败只记录日志，不影响在线推送
+func (w *chunkLogWriter) flush() {
+	if w == nil {
+		return
+	}
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending, w.bytes = nil, 0
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := w.messages.appendChunkLogs(batch); err != nil {
+		log.Printf("appendChunkLogs failed, message %s chunks %d-%d: %v",
+			w.messageID, batch[0].ChunkID, batch[len(batch)-1].ChunkID, err)
+	}
+}
+
+// close 流结束时写入剩余的chunk，之后不再接受新的chunk
+func (w *chunkLogWriter) close() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.flush()
+}
+
+// loadChunkLogs 按顺序读取一条消息的chunk日志
+func (s *MessageService) loadChunkLogs(sessionID, messageID string) ([]models.StreamChunkLog, error) {
+	var records []models.StreamChunkLog
+	err := s.db.Where("session_id = ? AND message_id = ?", sessionID, messageID).
+		Order("chunk_id ASC").
+		Find(&records).Error
+	return records, err
+}
+
+// deleteChunkLogs 删除消息的chunk日志，终态已入库、续传保留期已过或消息被删除时调用
+func (s *MessageService) deleteChunkLogs(sessionID string, messageIDs ...string) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+	return s.db.Where("session_id = ? AND message_id IN ?", sessionID, messageIDs).
+		Delete(&models.StreamChunkLog{}).Error
+}
+
+// pruneChunkLogs 删除 before 之前写入的、消息已不在生成中的chunk日志
+// 进程在 janitor 清理之前退出时遗留的日志由启动时的恢复流程清理
+func (s *MessageService) pruneChunkLogs(before time.Time) (int64, error) {
+	processing := s.db.Model(&models.Message{}).
+		Select("id").
+		Where("status = ?", constant.MessageStatusProcessing)
+	result := s.db.Where("created_at < ? AND message_id NOT IN (?)", before, processing).
+		Delete(&models.StreamChunkLog{})
+	return result.RowsAffected, result.Error
+}
+
+// loadStreamFromLog 进程内没有该流时（如服务重启后），从chunk日志重建一个只读的流状态用于续传
+// 消息仍在生成中但没有任何进程持有时，按中断处理
+func (s *MessageService) loadStreamFromLog(sessionID, messageID string) (*StreamState, error) {
+	msg, err := s.GetMessageById(sessionID, messageID)
+	if err != nil {
+		return nil, constant.ErrStreamNotFound
+	}
+	if msg.Role != constant.RoleAssistant || msg.Deleted {
+		return nil, &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "只能续传助手消息"}
+	}
+
+	records, err := s.loadChunkLogs(sessionID, messageID)
+	if err != nil {
+		return nil, response.WrapError(500, "读取流日志失败", err)
+	}
+	// 没有chunk日志（历史消息，或日志已在续传保留期后清理）时无法还原chunk边界，
+	// 续传的序号会错位，由客户端重新获取完整消息
+	if len(records) == 0 {
+		return nil, constant.ErrStreamExpired
+	}
+
+	stream := &StreamState{
+		SessionID: sessionID,
+		MessageID: messageID,
+		ParentID:  msg.ParentID,
+		Chunks:    make([]string, 0, len(records)),
+		CreatedAt: msg.CreatedAt,
+		UpdatedAt: msg.UpdatedAt,
+		Clients:   make(map[string]chan struct{}),
+	}
+	var sb strings.Builder
+	for _, record := range records {
+		stream.Chunks = append(stream.Chunks, record.Content)
+		sb.WriteString(record.Content)
+	}
+	stream.FullResponse = sb.String()
+
+	if msg.Status == constant.MessageStatusCompleted {
+		stream.IsCompleted = true
+	} else {
+		stream.IsBreak = true
+	}
+	return stream, nil
+}
+
+// RecoverOrphanedStreams 启动时调用：把上次进程遗留的 PROCESSING 助手消息
+// 用chunk日志中的部分内容补全，并标记为 INTERRUPTED，再清理过期的chunk日志
+func (sm *StreamManager) RecoverOrphanedStreams() {
+	var orphans []models.Message
+	err := sm.messages.db.Where("role = ? AND status = ? AND deleted = ?",
+		constant.RoleAssistant, constant.MessageStatusProcessing, false).
+		Find(&orphans).Error
+	if err != nil {
+		log.Printf("RecoverOrphanedStreams: query failed: %v", err)
+		return
+	}
+
+	for _, msg := range orphans {
+		// 其它实例仍在生成的消息不处理
+		if owner, ok := sm.remoteStreamOwner(msg.SessionID, msg.ID); ok {
+			log.Printf("RecoverOrphanedStreams: message %s is still streaming on %s", msg.ID, owner)
+			continue
+		}
+		records, err := sm.messages.loadChunkLogs(msg.SessionID, msg.ID)
+		if err != nil {
+			log.Printf("RecoverOrphanedStreams: load chunks of %s failed: %v", msg.ID, err)
+			continue
+		}
+		var sb strings.Builder
+		for _, record := range records {
+			sb.WriteString(record.Content)
+		}
+		content := sb.String()
+		if len(content) < len(msg.Content) {
+			content = msg.Content
+		}
+
+		metadata := msg.Metadata
+		if metadata == nil {
+			metadata = models.JSONMap{}
+		}
+		metadata["break"] = true
+		metadata["recovered"] = true
+		tokens := countTokens(sm.tokenizers, "", content)
+		if err := sm.messages.updateMessageResult(&models.Message{
+			ID:               msg.ID,
+			Content:          content,
+			Status:           constant.MessageStatusInterrupted,
+			TokenCount:       tokens,
+			PromptTokens:     msg.PromptTokens,
+			CompletionTokens: tokens,
+			Metadata:         metadata,
+		}); err != nil {
+			log.Printf("RecoverOrphanedStreams: update %s failed: %v", msg.ID, err)
+			continue
+		}
+		log.Printf("RecoverOrphanedStreams: message %s marked interrupted with %d chunks", msg.ID, len(records))
+	}
+
+	// 上次进程遗留的、已过续传保留期的日志，内容都已写入消息
+	n, err := sm.messages.pruneChunkLogs(time.Now().Add(-sm.cfg.Janitor.CompletedTTL))
+	if err != nil {
+		log.Printf("RecoverOrphanedStreams: prune chunk logs failed: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("RecoverOrphanedStreams: pruned %d chunk logs", n)
+	}
+}
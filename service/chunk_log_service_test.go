@@ -0,0 +1,101 @@
+package service
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	constant "session-management/const"
+	"session-management/models"
+)
+
+func TestChunkLogWriterBatches(t *testing.T) {
+	chat, messages := newTestChatService(t)
+	sm := chat.streams
+	sm.cfg.ChunkLog.FlushBytes = 8
+	stream := sm.GetOrCreateStream("s", "m", "u", "q", false)
+	w := stream.chunkLog
+
+	count := func() int {
+		logs, err := messages.loadChunkLogs("s", "m")
+		if err != nil {
+			t.Fatalf("loadChunkLogs: %v", err)
+		}
+		return len(logs)
+	}
+
+	// 未到字节阈值和时间窗口时只缓存，不写数据库
+	if w.add(0, "abc") || w.add(1, "def") {
+		t.Fatal("add requested a flush below FlushBytes")
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("%d chunk logs written before flush", n)
+	}
+
+	// 达到字节阈值时由调用方写入
+	if !w.add(2, "gh") {
+		t.Fatal("add did not request a flush at FlushBytes")
+	}
+	w.flush()
+	if n := count(); n != 3 {
+		t.Fatalf("%d chunk logs after flush, want 3", n)
+	}
+
+	// 结束时写入剩余部分，之后不再接受新的chunk
+	w.add(3, "i")
+	sm.finishLocal(stream.Key(), StreamChunk{IsCompleted: true}, "", nil)
+	if w.add(4, "j") {
+		t.Error("add after close requested a flush")
+	}
+	w.flush()
+	logs, err := messages.loadChunkLogs("s", "m")
+	if err != nil || len(logs) != 4 || logs[3].Content != "i" {
+		t.Errorf("chunk logs after close = %+v, %v", logs, err)
+	}
+}
+
+func TestChunkLogWriterFlushesOnTimer(t *testing.T) {
+	chat, messages := newTestChatService(t)
+	sm := chat.streams
+	sm.cfg.ChunkLog.FlushInterval = 20 * time.Millisecond
+	stream := sm.GetOrCreateStream("s", "m", "u", "q", false)
+
+	stream.chunkLog.add(0, "a")
+	stream.chunkLog.add(1, "b")
+	waitFor(t, func() bool {
+		logs, err := messages.loadChunkLogs("s", "m")
+		return err == nil && len(logs) == 2
+	})
+}
+
+func TestLoadStreamFromLog(t *testing.T) {
+	_, messages := newTestChatService(t)
+
+	// 日志已清理：无法还原chunk边界，要求客户端重新获取消息
+	if _, err := messages.loadStreamFromLog("s", "m"); err != constant.ErrStreamExpired {
+		t.Fatalf("without chunk logs: err = %v, want ErrStreamExpired", err)
+	}
+
+	err := messages.appendChunkLogs([]models.StreamChunkLog{
+		{SessionID: "s", MessageID: "m", ChunkID: 1, Content: "lo", CreatedAt: time.Now()},
+		{SessionID: "s", MessageID: "m", ChunkID: 0, Content: "hel", CreatedAt: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := messages.loadStreamFromLog("s", "m")
+	if err != nil {
+		t.Fatalf("loadStreamFromLog: %v", err)
+	}
+	if !slices.Equal(stream.Chunks, []string{"hel", "lo"}) || stream.FullResponse != "hello" {
+		t.Errorf("chunks = %q, full response = %q", stream.Chunks, stream.FullResponse)
+	}
+	// 仍为 PROCESSING 但没有进程持有的消息按中断处理
+	if !stream.IsBreak || stream.IsCompleted {
+		t.Errorf("IsBreak = %v, IsCompleted = %v", stream.IsBreak, stream.IsCompleted)
+	}
+
+	if _, err := messages.loadStreamFromLog("s", "missing"); err != constant.ErrStreamNotFound {
+		t.Errorf("unknown message: err = %v, want ErrStreamNotFound", err)
+	}
+}
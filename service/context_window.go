@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"log"
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/pkg/tokenizer"
+	"strings"
+	"time"
+)
+
+// ModelSvcsConfig 中与上下文窗口相关的配置项
+const (
+	ModelCfgContextTokens = "context_tokens" // 覆盖模型的上下文上限
+	ModelCfgReserveTokens = "reserve_tokens" // 为回复预留的 token 数
+	ModelCfgSummarize     = "summarize"      // 超出上限时是否对较早的轮次生成摘要，默认开启
+)
+
+const (
+	defaultContextTokens = 8192
+	defaultReserveTokens = 1024
+	// summaryMaxTokens 摘要本身占用的预算
+	summaryMaxTokens = 512
+	// metadataContextSummary 摘要存放在所覆盖的最后一条消息的 Metadata 中
+	metadataContextSummary = "context_summary"
+)
+
+// modelContextLimits 常见模型的上下文上限
+var modelContextLimits = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4o-mini":   128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"qwen-turbo":    131072,
+	"qwen-plus":     131072,
+	"qwen-max":      32768,
+	"deepseek-chat": 65536,
+}
+
+// ContextPolicy 上下文窗口策略
+type ContextPolicy struct {
+	MaxTokens     int  // 模型上下文上限
+	ReserveTokens int  // 为回复预留
+	Summarize     bool // 被丢弃的轮次是否生成摘要
+}
+
+// Budget 可用于 prompt 的 token 数
+func (p ContextPolicy) Budget() int {
+	return p.MaxTokens - p.ReserveTokens
+}
+
+// ContextPolicyFor 根据项目模型服务配置得到上下文策略
+func ContextPolicyFor(cfg models.JSONMap) ContextPolicy {
+	policy := ContextPolicy{
+		MaxTokens:     defaultContextTokens,
+		ReserveTokens: defaultReserveTokens,
+		Summarize:     true,
+	}
+	if limit, ok := modelContextLimits[jsonMapString(cfg, ModelCfgModel)]; ok {
+		policy.MaxTokens = limit
+	}
+	if v, ok := jsonMapFloat(cfg, ModelCfgContextTokens); ok && v > 0 {
+		policy.MaxTokens = int(v)
+	}
+	if v, ok := jsonMapFloat(cfg, ModelCfgReserveTokens); ok && v >= 0 {
+		policy.ReserveTokens = int(v)
+	} else if v, ok := jsonMapFloat(cfg, ModelCfgMaxTokens); ok && v > 0 {
+		policy.ReserveTokens = int(v)
+	}
+	if v, ok := cfg[ModelCfgSummarize].(bool); ok {
+		policy.Summarize = v
+	}
+	return policy
+}
+
+// messageTokens 单条消息的 token 数，含角色等格式开销
+func messageTokens(t tokenizer.Tokenizer, msg ChatMessage) int {
+	return t.Count(msg.Content) + 4
+}
+
+// fitHistory 在预算内从最新的轮次往前保留历史，返回被丢弃的前缀长度
+// 保留部分总是从用户消息开始，避免出现没有问题的孤立回答
+func fitHistory(t tokenizer.Tokenizer, history []ChatMessage, budget int) int {
+	used := 0
+	cut := len(history)
+	for i := len(history) - 1; i >= 0; i-- {
+		used += messageTokens(t, history[i])
+		if used > budget {
+			break
+		}
+		cut = i
+	}
+	for cut < len(history) && history[cut].Role != constant.RoleUser {
+		cut++
+	}
+	return cut
+}
+
+// applyContextPolicy 按策略裁剪历史，被裁掉的轮次尽量用摘要代替
+// fixed 为 system 和当前用户消息，不参与裁剪
+func (b *PromptBuilder) applyContextPolicy(historyMsgs []models.Message, fixed []ChatMessage) (summary string, kept []ChatMessage) {
+	historyMsgs = filterHistory(historyMsgs)
+	history := historyToChatMessages(historyMsgs)
+	policy := ContextPolicyFor(b.ModelConfig())
+	t := b.tokenizers.ForModel(jsonMapString(b.ModelConfig(), ModelCfgModel))
+
+	budget := policy.Budget()
+	for _, msg := range fixed {
+		budget -= messageTokens(t, msg)
+	}
+
+	cut := fitHistory(t, history, budget)
+	if cut == 0 {
+		return "", history
+	}
+	if !policy.Summarize {
+		log.Printf("context window: session %s dropped %d messages", b.SessionID, cut)
+		return "", history[cut:]
+	}
+
+	// 为摘要预留空间后重新裁剪
+	cut = fitHistory(t, history, budget-summaryMaxTokens)
+	summary = b.summarize(historyMsgs[:cut])
+	log.Printf("context window: session %s summarized %d messages", b.SessionID, cut)
+	return summary, history[cut:]
+}
+
+// summarize 生成覆盖 dropped 的摘要，复用已有摘要，只对新增部分增量总结
+// 失败或所属流被中断时返回已有摘要（可能为空），调用方直接截断
+func (b *PromptBuilder) summarize(dropped []models.Message) string {
+	if len(dropped) == 0 {
+		return ""
+	}
+	last := dropped[len(dropped)-1]
+
+	// 从后往前找最近一条带摘要的消息
+	prevSummary, start := "", 0
+	for i := len(dropped) - 1; i >= 0; i-- {
+		if text := storedSummary(dropped[i]); text != "" {
+			prevSummary, start = text, i+1
+			break
+		}
+	}
+	if start == len(dropped) {
+		return prevSummary
+	}
+
+	provider, err := b.providers.ForConfig(b.ModelConfig())
+	if err != nil {
+		log.Printf("summarize: %v", err)
+		return prevSummary
+	}
+
+	var transcript strings.Builder
+	if prevSummary != "" {
+		transcript.WriteString("此前的摘要:\n" + prevSummary + "\n\n")
+	}
+	transcript.WriteString("对话:\n")
+	for _, msg := range historyToChatMessages(dropped[start:]) {
+		transcript.WriteString(msg.Role + ": " + msg.Content + "\n")
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, time.Minute)
+	defer cancel()
+	result, err := CompleteChat(ctx, provider, &ChatRequest{
+		Messages: []ChatMessage{
+			{Role: constant.RoleSystem, Content: "请用简洁的中文总结以下对话的要点，保留事实、结论和用户偏好，不超过300字。"},
+			{Role: constant.RoleUser, Content: transcript.String()},
+		},
+		Config: b.ModelConfig(),
+	})
+	if err != nil {
+		log.Printf("summarize: provider %s failed: %v", provider.Name(), err)
+		return prevSummary
+	}
+
+	// 摘要存放在覆盖的最后一条消息上，后续轮次直接复用
+	metadata := last.Metadata
+	if metadata == nil {
+		metadata = models.JSONMap{}
+	}
+	metadata[metadataContextSummary] = map[string]any{
+		"text":         result.Content,
+		"covers_count": len(dropped),
+		"model":        result.Model,
+		"created_at":   time.Now(),
+	}
+	if err := b.messages.updateMessageMetadata(last.ID, metadata); err != nil {
+		log.Printf("summarize: save summary on %s failed: %v", last.ID, err)
+	}
+	return result.Content
+}
+
+// storedSummary 读取消息上保存的摘要
+func storedSummary(msg models.Message) string {
+	summary, ok := msg.Metadata[metadataContextSummary].(map[string]any)
+	if !ok {
+		return ""
+	}
+	text, _ := summary["text"].(string)
+	return text
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/pkg/tokenizer"
+)
+
+// chatTurns 按 user、assistant 交替构造消息，每条内容 4 个字符（启发式分词 1 个 token，含开销 5 个）
+func chatTurns(contents ...string) []ChatMessage {
+	turns := make([]ChatMessage, len(contents))
+	for i, content := range contents {
+		role := constant.RoleUser
+		if i%2 == 1 {
+			role = constant.RoleAssistant
+		}
+		turns[i] = ChatMessage{Role: role, Content: content}
+	}
+	return turns
+}
+
+func TestFitHistory(t *testing.T) {
+	history := chatTurns("u1..", "a1..", "u2..", "a2..", "u3..")
+	tests := []struct {
+		name   string
+		budget int
+		want   int
+	}{
+		{"everything fits", 100, 0},
+		{"exact fit", 25, 0},
+		// 能保留到 a1，但不能从助手消息开始，前移到 u2
+		{"skip leading assistant", 24, 2},
+		{"keep from u2", 15, 2},
+		{"keep only u3", 5, 4},
+		{"nothing fits", 4, 5},
+		{"negative budget", -10, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fitHistory(tokenizer.Heuristic{}, history, tt.budget); got != tt.want {
+				t.Errorf("fitHistory(budget %d) = %d, want %d", tt.budget, got, tt.want)
+			}
+		})
+	}
+
+	if got := fitHistory(tokenizer.Heuristic{}, nil, 100); got != 0 {
+		t.Errorf("fitHistory(nil) = %d, want 0", got)
+	}
+	// 只剩助手消息时全部丢弃
+	if got := fitHistory(tokenizer.Heuristic{}, chatTurns("u1..", "a1..")[1:], 100); got != 1 {
+		t.Errorf("fitHistory(assistant only) = %d, want 1", got)
+	}
+}
+
+func TestAssembleKeepsCurrentTurn(t *testing.T) {
+	var history []models.Message
+	for _, msg := range chatTurns("u1..", "a1..", "u2..", "a2..") {
+		history = append(history, models.Message{Role: msg.Role, Content: msg.Content})
+	}
+	current := ChatMessage{Role: constant.RoleUser, Content: "u3.."}
+
+	tests := []struct {
+		name          string
+		contextTokens float64
+		want          string
+	}{
+		{"whole history", 100, "u1.. a1.. u2.. a2.. u3.."},
+		{"trimmed to the last turn", 15, "u2.. a2.. u3.."},
+		{"only the current turn", 12, "u3.."},
+		// 当前用户消息本身超出上限时仍然发送
+		{"current turn over budget", 1, "u3.."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &PromptBuilder{
+				SessionID: "s",
+				ctx:       context.Background(),
+				project: &models.Project{ModelSvcsConfig: models.JSONMap{
+					ModelCfgContextTokens: tt.contextTokens,
+					ModelCfgReserveTokens: 0.0,
+					ModelCfgSummarize:     false,
+				}},
+				tokenizers: tokenizer.NewRegistry(nil),
+			}
+			var got []string
+			for _, msg := range b.assemble(history, current) {
+				got = append(got, msg.Content)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("assemble = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// newSummaryTestBuilder 在临时库中写入按 user、assistant 交替的消息 h0、h1…，
+// 返回以 provider 生成摘要的 PromptBuilder 和消息服务
+func newSummaryTestBuilder(t *testing.T, provider Provider, contents ...string) (*PromptBuilder, *MessageService) {
+	t.Helper()
+	db := openTestDB(t, &models.Message{})
+	now := time.Now()
+	for i, msg := range chatTurns(contents...) {
+		err := db.Create(&models.Message{
+			ID:        fmt.Sprintf("h%d", i),
+			SessionID: "s",
+			Role:      msg.Role,
+			Content:   msg.Content,
+			Status:    constant.MessageStatusCompleted,
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+			UpdatedAt: now,
+		}).Error
+		if err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+	}
+	providers := NewProviderRegistry()
+	providers.Register(provider)
+	messages := NewMessageService(db, nil)
+	return &PromptBuilder{
+		SessionID:  "s",
+		ctx:        context.Background(),
+		project:    &models.Project{ModelSvcsConfig: models.JSONMap{ModelCfgProvider: provider.Name()}},
+		messages:   messages,
+		providers:  providers,
+		tokenizers: tokenizer.NewRegistry(nil),
+	}, messages
+}
+
+// loadHistory 按创建时间读取会话 s 的消息，包含已保存的摘要
+func loadHistory(t *testing.T, messages *MessageService) []models.Message {
+	t.Helper()
+	var history []models.Message
+	if err := messages.db.Where("session_id = ?", "s").Order("created_at").Find(&history).Error; err != nil {
+		t.Fatal(err)
+	}
+	return history
+}
+
+func TestSummarizeReusesStoredSummary(t *testing.T) {
+	// 记录每次调用的对话内容，回复 "summary N"
+	var transcripts []string
+	b, messages := newSummaryTestBuilder(t, &ScriptedProvider{
+		ProviderName: "summary",
+		Script: func(req *ChatRequest) string {
+			transcripts = append(transcripts, req.Messages[len(req.Messages)-1].Content)
+			return fmt.Sprintf("summary %d", len(transcripts))
+		},
+	}, "u1..", "a1..", "u2..", "a2..")
+
+	if got := b.summarize(nil); got != "" || len(transcripts) != 0 {
+		t.Fatalf("summarize(nil) = %q after %d calls, want no call", got, len(transcripts))
+	}
+
+	history := loadHistory(t, messages)
+	if got := b.summarize(history[:2]); got != "summary 1" {
+		t.Fatalf("first summarize = %q, want summary 1", got)
+	}
+	if strings.Contains(transcripts[0], "此前的摘要") || !strings.Contains(transcripts[0], "user: u1..\nassistant: a1..") {
+		t.Errorf("first transcript = %q", transcripts[0])
+	}
+	history = loadHistory(t, messages)
+	if got := storedSummary(history[1]); got != "summary 1" {
+		t.Fatalf("summary stored on h1 = %q, want summary 1", got)
+	}
+
+	// 覆盖范围没有变化时直接复用，不再调用模型
+	if got := b.summarize(history[:2]); got != "summary 1" || len(transcripts) != 1 {
+		t.Fatalf("repeated summarize = %q after %d calls, want summary 1 after 1 call", got, len(transcripts))
+	}
+
+	// 覆盖范围扩大时只总结新增部分，并带上此前的摘要
+	if got := b.summarize(history); got != "summary 2" || len(transcripts) != 2 {
+		t.Fatalf("incremental summarize = %q after %d calls, want summary 2 after 2 calls", got, len(transcripts))
+	}
+	if !strings.Contains(transcripts[1], "此前的摘要:\nsummary 1") || strings.Contains(transcripts[1], "u1..") ||
+		!strings.Contains(transcripts[1], "user: u2..\nassistant: a2..") {
+		t.Errorf("incremental transcript = %q", transcripts[1])
+	}
+	if got := storedSummary(loadHistory(t, messages)[3]); got != "summary 2" {
+		t.Errorf("summary stored on h3 = %q, want summary 2", got)
+	}
+
+	// 提供方不可用时退回已有摘要
+	b.project.ModelSvcsConfig = models.JSONMap{ModelCfgProvider: "missing"}
+	if got := b.summarize(history[:3]); got != "summary 1" || len(transcripts) != 2 {
+		t.Errorf("summarize without provider = %q after %d calls, want summary 1 after 2 calls", got, len(transcripts))
+	}
+}
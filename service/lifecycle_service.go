@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"session-management/response"
+	"time"
+)
+
+// ErrServerShuttingDown 服务停止中，不再接受新的对话
+var ErrServerShuttingDown = &response.BizError{HttpStatus: http.StatusServiceUnavailable, Code: 503, Msg: "服务正在重启，请稍后重试"}
+
+// BeginShutdown 进入停止流程：不再接受新的对话，已连接的客户端收到 server_restarting 事件
+func (sm *StreamManager) BeginShutdown() {
+	sm.shutdownOnce.Do(func() {
+		close(sm.shutdownCh)
+	})
+}
+
+// ShuttingDown 进入停止流程后关闭的通道
+func (sm *StreamManager) ShuttingDown() <-chan struct{} {
+	return sm.shutdownCh
+}
+
+// checkAcceptingChats 停止流程中拒绝新的对话
+func (sm *StreamManager) checkAcceptingChats() error {
+	select {
+	case <-sm.shutdownCh:
+		return ErrServerShuttingDown
+	default:
+		return nil
+	}
+}
+
+// DrainStreams 等待本实例生成中的流结束，ctx 到期后中断剩余的流并以 INTERRUPTED 入库
+// 返回被中断的流数量
+func (sm *StreamManager) DrainStreams(ctx context.Context) int {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for sm.localStreamCount() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return sm.breakAll(BreakReasonShutdown)
+		}
+	}
+	// 只剩镜像流，生成所在实例会继续推送，这里只结束本实例的客户端
+	sm.breakAll(BreakReasonShutdown)
+	return 0
+}
+
+// Shutdown 停止服务：拒绝新对话，等待生成结束（最长 timeout），再关闭 HTTP 服务和总线
+func (sm *StreamManager) Shutdown(srv *http.Server, timeout time.Duration) {
+	sm.BeginShutdown()
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if n := sm.DrainStreams(drainCtx); n > 0 {
+		log.Printf("shutdown: %d streams interrupted", n)
+	}
+
+	// 流都已结束，SSE 请求会在发送结束事件后返回
+	httpCtx, httpCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer httpCancel()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		log.Printf("shutdown: http server: %v", err)
+	}
+	if err := sm.bus.Close(); err != nil {
+		log.Printf("shutdown: stream bus: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBeginShutdown(t *testing.T) {
+	sm := NewStreamManager(nil, nil, nil, testStreamConfig(), "test")
+	other := NewStreamManager(nil, nil, nil, testStreamConfig(), "other")
+	if err := sm.checkAcceptingChats(); err != nil {
+		t.Fatalf("before shutdown: %v", err)
+	}
+
+	sm.BeginShutdown()
+	// 重复调用不会重复关闭通道
+	sm.BeginShutdown()
+	select {
+	case <-sm.ShuttingDown():
+	default:
+		t.Error("ShuttingDown not closed")
+	}
+	if err := sm.checkAcceptingChats(); !errors.Is(err, ErrServerShuttingDown) {
+		t.Errorf("after shutdown: err = %v, want ErrServerShuttingDown", err)
+	}
+
+	// 停止状态属于各自的实例
+	if err := other.checkAcceptingChats(); err != nil {
+		t.Errorf("other manager: %v", err)
+	}
+}
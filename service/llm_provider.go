@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	constant "session-management/const"
+	"session-management/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProviderName 未配置 llm.default_provider 时使用的模型提供方
+const DefaultProviderName = OpenAIProviderName
+
+// ChatMessage 发送给模型的一条结构化消息
+type ChatMessage struct {
+	Role    string `json:"role"`    // system、user、assistant
+	Content string `json:"content"` // 消息内容
+}
+
+// ChatRequest 模型对话请求
+type ChatRequest struct {
+	Messages []ChatMessage  `json:"messages"` // 按顺序排列的消息列表
+	Config   models.JSONMap `json:"config"`   // 项目的模型服务配置（Project.ModelSvcsConfig）
+}
+
+// Usage token 用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatResult 一次模型调用的最终结果
+type ChatResult struct {
+	Content      string `json:"content"`       // 完整回复
+	Model        string `json:"model"`         // 实际使用的模型
+	FinishReason string `json:"finish_reason"` // 结束原因，如 stop、length、canceled
+	Usage        *Usage `json:"usage"`         // token 用量，提供方不返回时为 nil
+}
+
+// ChunkHandler 接收模型增量输出的回调，返回错误时提供方应停止生成
+type ChunkHandler func(delta string) error
+
+// Provider 大模型提供方接口
+// StreamChat 按顺序回调增量内容，ctx 取消时必须尽快返回 ctx.Err()
+type Provider interface {
+	Name() string
+	StreamChat(ctx context.Context, req *ChatRequest, onDelta ChunkHandler) (*ChatResult, error)
+}
+
+// ProviderRegistry 提供方注册表，name -> Provider
+// 项目没有指定 provider 时（包括没有项目的会话和上下文摘要）使用 defaultName
+type ProviderRegistry struct {
+	providers   map[string]Provider
+	defaultName string
+	mu          sync.RWMutex
+}
+
+// NewProviderRegistry 创建空的提供方注册表，默认提供方为 DefaultProviderName
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		providers:   make(map[string]Provider),
+		defaultName: DefaultProviderName,
+	}
+}
+
+// Register 注册一个提供方，同名覆盖
+func (r *ProviderRegistry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[p.Name()] = p
+}
+
+// SetDefault 设置默认提供方，提供方需已注册
+func (r *ProviderRegistry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.providers[name]; !ok {
+		return fmt.Errorf("default provider %q not registered", name)
+	}
+	r.defaultName = name
+	return nil
+}
+
+// Get 按名称获取提供方，name 为空时返回默认提供方
+func (r *ProviderRegistry) Get(name string) (Provider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" {
+		name = r.defaultName
+	}
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("provider %q not registered", name)
+	}
+	return p, nil
+}
+
+// ForConfig 根据项目模型服务配置中的 provider 字段选择提供方
+func (r *ProviderRegistry) ForConfig(cfg models.JSONMap) (Provider, error) {
+	return r.Get(jsonMapString(cfg, ModelCfgProvider))
+}
+
+// CompleteChat 非流式调用，收集所有增量后返回完整结果
+func CompleteChat(ctx context.Context, p Provider, req *ChatRequest) (*ChatResult, error) {
+	var sb strings.Builder
+	result, err := p.StreamChat(ctx, req, func(delta string) error {
+		sb.WriteString(delta)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = &ChatResult{}
+	}
+	if result.Content == "" {
+		result.Content = sb.String()
+	}
+	return result, nil
+}
+
+// ScriptedProvider 按固定脚本逐字输出的提供方，结果确定，只用于测试，不会注册到服务中
+type ScriptedProvider struct {
+	ProviderName string
+	Script       func(req *ChatRequest) string // 根据请求生成完整回复
+	Delay        time.Duration                 // 每个字符之间的间隔
+}
+
+func (p *ScriptedProvider) Name() string {
+	return p.ProviderName
+}
+
+func (p *ScriptedProvider) StreamChat(ctx context.Context, req *ChatRequest, onDelta ChunkHandler) (*ChatResult, error) {
+	reply := p.Script(req)
+	var sb strings.Builder
+	for _, ch := range reply {
+		if err := ctx.Err(); err != nil {
+			return &ChatResult{Content: sb.String(), Model: p.ProviderName, FinishReason: "canceled"}, err
+		}
+		delta := string(ch)
+		if err := onDelta(delta); err != nil {
+			return &ChatResult{Content: sb.String(), Model: p.ProviderName, FinishReason: "canceled"}, err
+		}
+		sb.WriteString(delta)
+		if p.Delay > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(p.Delay):
+			}
+		}
+	}
+	return &ChatResult{Content: sb.String(), Model: p.ProviderName, FinishReason: "stop"}, nil
+}
+
+// NewEchoProvider 原样回显最后一条用户消息的提供方，用于测试
+func NewEchoProvider() *ScriptedProvider {
+	return &ScriptedProvider{
+		ProviderName: "echo",
+		Script: func(req *ChatRequest) string {
+			for i := len(req.Messages) - 1; i >= 0; i-- {
+				if req.Messages[i].Role == constant.RoleUser {
+					return req.Messages[i].Content
+				}
+			}
+			return ""
+		},
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+
+	"session-management/models"
+)
+
+func TestProviderRegistry(t *testing.T) {
+	providers := NewProviderRegistry()
+	if _, err := providers.Get(""); err == nil {
+		t.Error("Get default from an empty registry: want error")
+	}
+	if err := providers.SetDefault("echo"); err == nil {
+		t.Error("SetDefault to an unregistered provider: want error")
+	}
+
+	echo := NewEchoProvider()
+	providers.Register(echo)
+	if err := providers.SetDefault("echo"); err != nil {
+		t.Fatalf("SetDefault: %v", err)
+	}
+	for _, cfg := range []models.JSONMap{nil, {}, {ModelCfgProvider: "echo"}} {
+		if p, err := providers.ForConfig(cfg); err != nil || p != echo {
+			t.Errorf("ForConfig(%v) = %v, %v, want echo", cfg, p, err)
+		}
+	}
+	if _, err := providers.ForConfig(models.JSONMap{ModelCfgProvider: "missing"}); err == nil {
+		t.Error("ForConfig with an unregistered provider: want error")
+	}
+
+	// 注册表之间互不影响
+	if _, err := NewProviderRegistry().Get("echo"); err == nil {
+		t.Error("provider registered on another registry: want error")
+	}
+}
@@ -2,24 +2,38 @@ package service
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	constant "session-management/const"
 	my_models "session-management/models"
 	"session-management/response"
+
+	"gorm.io/gorm"
 )
 
+// MessageService 消息服务：消息、分支和流式生成的chunk日志
+type MessageService struct {
+	db       *gorm.DB
+	sessions *SessionService
+}
+
+// 创建消息服务
+func NewMessageService(db *gorm.DB, sessions *SessionService) *MessageService {
+	return &MessageService{db: db, sessions: sessions}
+}
+
 // 保存一条消息到数据库
-func CreateAndSaveMessage(msg *my_models.Message) error {
-	if err := Dbservice.DB.Create(msg).Error; err != nil {
+func (s *MessageService) CreateAndSaveMessage(msg *my_models.Message) error {
+	if err := s.db.Create(msg).Error; err != nil {
 		return response.WrapError(500, "创建消息失败", err)
 	}
 	return nil
 }
 
 // 查询会话的所有消息
-func ListMessagesBySession(userID, sessionID string) ([]my_models.Message, error) {
+func (s *MessageService) ListMessagesBySession(userID, sessionID string) ([]my_models.Message, error) {
 	var messages []my_models.Message
-	err := Dbservice.DB.Where("session_id = ? AND deleted = ?", sessionID, false).
+	err := s.db.Where("session_id = ? AND deleted = ?", sessionID, false).
 		Order("created_at ASC").
 		Find(&messages).Error
 	if err != nil {
@@ -29,16 +43,16 @@ func ListMessagesBySession(userID, sessionID string) ([]my_models.Message, error
 }
 
 // 更新消息状态，全量更新
-func updateMessageById(message *my_models.Message) error {
-	if err := Dbservice.DB.Save(message).Error; err != nil {
+func (s *MessageService) updateMessageById(message *my_models.Message) error {
+	if err := s.db.Save(message).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 // 更新消息的特定字段
-func updateMessageFields(messageId string, updates map[string]any) error {
-	result := Dbservice.DB.Model(&my_models.Message{}).
+func (s *MessageService) updateMessageFields(messageId string, updates map[string]any) error {
+	result := s.db.Model(&my_models.Message{}).
 		Where("id = ?", messageId).
 		Updates(updates)
 
@@ -54,10 +68,31 @@ func updateMessageFields(messageId string, updates map[string]any) error {
 	return nil
 }
 
+// 更新消息的生成结果：内容、状态、token数和元信息
+func (s *MessageService) updateMessageResult(message *my_models.Message) error {
+	result := s.db.Model(&my_models.Message{ID: message.ID}).
+		Select("content", "status", "token_count", "prompt_tokens", "completion_tokens", "metadata").
+		Updates(message)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("message with id %s not found", message.ID)
+	}
+	return nil
+}
+
+// 更新消息的元信息
+func (s *MessageService) updateMessageMetadata(messageId string, metadata my_models.JSONMap) error {
+	return s.db.Model(&my_models.Message{ID: messageId}).
+		Select("metadata").
+		Updates(&my_models.Message{Metadata: metadata}).Error
+}
+
 // 查询会话的一条消息
-func GetMessageById(sessionID, messageID string) (*my_models.Message, error) {
+func (s *MessageService) GetMessageById(sessionID, messageID string) (*my_models.Message, error) {
 	var message my_models.Message
-	err := Dbservice.DB.Where("id = ? AND session_id = ?", messageID, sessionID).
+	err := s.db.Where("id = ? AND session_id = ?", messageID, sessionID).
 		First(&message).Error
 	if err != nil {
 		return nil, response.WrapError(http.StatusNotFound, "查询消息失败", err)
@@ -66,9 +101,9 @@ func GetMessageById(sessionID, messageID string) (*my_models.Message, error) {
 }
 
 // 删除会话的一条消息，及后续消息
-func DeleteMessage(sessionID, messageID string) error {
+func (s *MessageService) DeleteMessage(sessionID, messageID string) error {
 	//先查询会话的所有消息
-	messages, err := ListMessagesBySession("", sessionID)
+	messages, err := s.ListMessagesBySession("", sessionID)
 	if err != nil {
 		return err
 	}
@@ -105,10 +140,14 @@ func DeleteMessage(sessionID, messageID string) error {
 
 	// 删除索引及后续消息
 	for _, msgID := range toDelete {
-		if err := updateMessageFields(msgID, map[string]any{"deleted": true}); err != nil {
+		if err := s.updateMessageFields(msgID, map[string]any{"deleted": true}); err != nil {
 			return err
 		}
 	}
+	// 已删除的消息不能续传，chunk日志一并删除
+	if err := s.deleteChunkLogs(sessionID, toDelete...); err != nil {
+		log.Printf("DeleteMessage: delete chunk logs of %v failed: %v", toDelete, err)
+	}
 
 	return nil
 }
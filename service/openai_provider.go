@@ -0,0 +1,306 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"session-management/config"
+	"session-management/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAIProviderName OpenAI 兼容协议提供方名称
+const OpenAIProviderName = "openai"
+
+// ModelSvcsConfig 中识别的配置项
+const (
+	ModelCfgProvider    = "provider"
+	ModelCfgBaseURL     = "base_url"
+	ModelCfgModel       = "model"
+	ModelCfgAPIKey      = "api_key"
+	ModelCfgTemperature = "temperature"
+	ModelCfgMaxTokens   = "max_tokens"
+)
+
+// OpenAIConfig OpenAI 兼容服务配置
+type OpenAIConfig struct {
+	BaseURL     string   `json:"base_url"`
+	Model       string   `json:"model"`
+	APIKey      string   `json:"-"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+
+	AllowedBaseURLs []string `json:"-"` // 项目可以改用的服务地址前缀
+}
+
+// merge 用项目的 ModelSvcsConfig 覆盖服务端默认值
+// 项目改用其它服务地址时，地址必须在允许列表中，且必须配置自己的 api_key：服务端的 key 不能发往项目选择的主机
+func (c OpenAIConfig) merge(cfg models.JSONMap) (OpenAIConfig, error) {
+	if v := jsonMapString(cfg, ModelCfgBaseURL); v != "" && !sameBaseURL(v, c.BaseURL) {
+		if !baseURLAllowed(v, c.AllowedBaseURLs) {
+			return c, fmt.Errorf("openai provider: base_url %q is not allowed", v)
+		}
+		if jsonMapString(cfg, ModelCfgAPIKey) == "" {
+			return c, fmt.Errorf("openai provider: api_key is required when base_url is overridden")
+		}
+		c.BaseURL = v
+		c.APIKey = ""
+	}
+	if v := jsonMapString(cfg, ModelCfgModel); v != "" {
+		c.Model = v
+	}
+	if v := jsonMapString(cfg, ModelCfgAPIKey); v != "" {
+		c.APIKey = v
+	}
+	if v, ok := jsonMapFloat(cfg, ModelCfgTemperature); ok {
+		c.Temperature = &v
+	}
+	if v, ok := jsonMapFloat(cfg, ModelCfgMaxTokens); ok && v > 0 {
+		c.MaxTokens = int(v)
+	}
+	return c, nil
+}
+
+// sameBaseURL 两个服务地址是否相同，忽略末尾的 /
+func sameBaseURL(a, b string) bool {
+	return strings.TrimRight(a, "/") == strings.TrimRight(b, "/")
+}
+
+// baseURLAllowed 服务地址的协议、主机（含端口）与某个允许的地址相同，且路径以其路径开头
+func baseURLAllowed(raw string, allowed []string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.User != nil {
+		return false
+	}
+	path := strings.TrimRight(u.Path, "/") + "/"
+	for _, a := range allowed {
+		prefix, err := url.Parse(a)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(u.Scheme, prefix.Scheme) && strings.EqualFold(u.Host, prefix.Host) &&
+			strings.HasPrefix(path, strings.TrimRight(prefix.Path, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// completionsURL 兼容 base_url 带或不带 /v1 两种写法
+func (c OpenAIConfig) completionsURL() string {
+	base := strings.TrimRight(c.BaseURL, "/")
+	if strings.HasSuffix(base, "/v1") {
+		return base + "/chat/completions"
+	}
+	return base + "/v1/chat/completions"
+}
+
+// OpenAIProvider 通过 /v1/chat/completions 流式接口调用 OpenAI 兼容服务
+type OpenAIProvider struct {
+	Defaults OpenAIConfig
+	Client   *http.Client
+}
+
+// NewOpenAIProvider 创建 OpenAI 兼容提供方，client 为 nil 时使用默认客户端
+func NewOpenAIProvider(defaults OpenAIConfig, client *http.Client) *OpenAIProvider {
+	if client == nil {
+		client = newOpenAIClient(10*time.Second, 2*time.Minute)
+	}
+	return &OpenAIProvider{Defaults: defaults, Client: client}
+}
+
+// newOpenAIClient 只限制建立连接和等待响应头的时间
+// 不设置 http.Client.Timeout：它包含读取响应体的时间，会截断较长的流式生成；响应体由请求的上下文控制
+func newOpenAIClient(dialTimeout, responseHeaderTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	return &http.Client{Transport: transport}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return OpenAIProviderName
+}
+
+// openAIChatReq /v1/chat/completions 请求体
+type openAIChatReq struct {
+	Model         string              `json:"model"`
+	Messages      []ChatMessage       `json:"messages"`
+	Stream        bool                `json:"stream"`
+	StreamOptions *openAIStreamOption `json:"stream_options,omitempty"`
+	Temperature   *float64            `json:"temperature,omitempty"`
+	MaxTokens     int                 `json:"max_tokens,omitempty"`
+}
+
+type openAIStreamOption struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIStreamFrame 流式响应中的一帧
+type openAIStreamFrame struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *OpenAIProvider) StreamChat(ctx context.Context, req *ChatRequest, onDelta ChunkHandler) (*ChatResult, error) {
+	cfg, err := p.Defaults.merge(req.Config)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BaseURL == "" || cfg.Model == "" {
+		return nil, fmt.Errorf("openai provider: base_url and model are required")
+	}
+
+	body, err := json.Marshal(openAIChatReq{
+		Model:         cfg.Model,
+		Messages:      req.Messages,
+		Stream:        true,
+		StreamOptions: &openAIStreamOption{IncludeUsage: true},
+		Temperature:   cfg.Temperature,
+		MaxTokens:     cfg.MaxTokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.completionsURL(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if cfg.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+
+	httpResp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(httpResp.Body, 4096))
+		return nil, fmt.Errorf("openai provider: status %d: %s", httpResp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	result := &ChatResult{Model: cfg.Model}
+	var sb strings.Builder
+
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// 跳过空行、注释和非 data 字段
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var frame openAIStreamFrame
+		if err := json.Unmarshal([]byte(data), &frame); err != nil {
+			return partialResult(result, &sb), fmt.Errorf("openai provider: decode frame: %w", err)
+		}
+		if frame.Error != nil {
+			return partialResult(result, &sb), fmt.Errorf("openai provider: %s", frame.Error.Message)
+		}
+		if frame.Model != "" {
+			result.Model = frame.Model
+		}
+		if frame.Usage != nil {
+			result.Usage = frame.Usage
+		}
+		for _, choice := range frame.Choices {
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				result.FinishReason = *choice.FinishReason
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if err := onDelta(choice.Delta.Content); err != nil {
+				result.FinishReason = "canceled"
+				return partialResult(result, &sb), err
+			}
+			sb.WriteString(choice.Delta.Content)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			result.FinishReason = "canceled"
+			return partialResult(result, &sb), ctxErr
+		}
+		return partialResult(result, &sb), fmt.Errorf("openai provider: read stream: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		result.FinishReason = "canceled"
+		return partialResult(result, &sb), err
+	}
+
+	return partialResult(result, &sb), nil
+}
+
+// partialResult 填充目前已生成的内容
+func partialResult(result *ChatResult, sb *strings.Builder) *ChatResult {
+	result.Content = sb.String()
+	return result
+}
+
+// jsonMapString 读取字符串配置
+func jsonMapString(m models.JSONMap, key string) string {
+	if v, ok := m[key].(string); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+// jsonMapFloat 读取数值配置，兼容 JSON 数字和字符串
+func jsonMapFloat(m models.JSONMap, key string) (float64, bool) {
+	switch v := m[key].(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// NewOpenAIProviderFromConfig 按服务配置创建 OpenAI 兼容提供方
+func NewOpenAIProviderFromConfig(cfg config.OpenAIConfig) *OpenAIProvider {
+	defaults := OpenAIConfig{
+		BaseURL:         cfg.BaseURL,
+		Model:           cfg.Model,
+		APIKey:          cfg.APIKey,
+		Temperature:     cfg.Temperature,
+		MaxTokens:       cfg.MaxTokens,
+		AllowedBaseURLs: cfg.AllowedBaseURLs,
+	}
+	return NewOpenAIProvider(defaults, newOpenAIClient(cfg.DialTimeout, cfg.ResponseHeaderTimeout))
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newOpenAIServer 启动模拟的 /v1/chat/completions 服务，收到的请求体写入 got
+func newOpenAIServer(t *testing.T, got *openAIChatReq, handle func(w http.ResponseWriter, r *http.Request)) *OpenAIProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if got != nil {
+			if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+		}
+		handle(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return NewOpenAIProvider(OpenAIConfig{BaseURL: srv.URL, Model: "gpt-test", APIKey: "sk-test"}, srv.Client())
+}
+
+// writeFrames 以 SSE 格式逐帧写出并刷新
+func writeFrames(w http.ResponseWriter, frames ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, frame := range frames {
+		fmt.Fprintf(w, "data: %s\n\n", frame)
+		w.(http.Flusher).Flush()
+	}
+}
+
+// collectDeltas 记录所有增量内容
+func collectDeltas(deltas *[]string) ChunkHandler {
+	return func(delta string) error {
+		*deltas = append(*deltas, delta)
+		return nil
+	}
+}
+
+func TestOpenAIStreamChatDeltas(t *testing.T) {
+	var got openAIChatReq
+	p := newOpenAIServer(t, &got, func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		writeFrames(w,
+			`{"model":"gpt-test-0613","choices":[{"delta":{"role":"assistant","content":""}}]}`,
+			`{"choices":[{"delta":{"content":"Hel"}}]}`,
+			`{"choices":[{"delta":{"content":"lo"},"finish_reason":null}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"stop"}]}`,
+			`[DONE]`,
+		)
+	})
+
+	var deltas []string
+	req := &ChatRequest{Messages: []ChatMessage{{Role: "user", Content: "hi"}}}
+	result, err := p.StreamChat(context.Background(), req, collectDeltas(&deltas))
+	if err != nil {
+		t.Fatalf("StreamChat: %v", err)
+	}
+	if !slices.Equal(deltas, []string{"Hel", "lo"}) {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if result.Content != "Hello" || result.Model != "gpt-test-0613" || result.FinishReason != "stop" || result.Usage != nil {
+		t.Errorf("result = %+v", result)
+	}
+	if got.Model != "gpt-test" || !got.Stream || got.StreamOptions == nil || !got.StreamOptions.IncludeUsage {
+		t.Errorf("request = %+v", got)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content != "hi" {
+		t.Errorf("request messages = %+v", got.Messages)
+	}
+}
+
+func TestOpenAIStreamChatUsage(t *testing.T) {
+	p := newOpenAIServer(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		writeFrames(w,
+			`{"choices":[{"delta":{"content":"ok"},"finish_reason":"stop"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":1,"total_tokens":8}}`,
+			`[DONE]`,
+		)
+	})
+
+	var deltas []string
+	result, err := p.StreamChat(context.Background(), &ChatRequest{}, collectDeltas(&deltas))
+	if err != nil {
+		t.Fatalf("StreamChat: %v", err)
+	}
+	want := Usage{PromptTokens: 7, CompletionTokens: 1, TotalTokens: 8}
+	if result.Usage == nil || *result.Usage != want {
+		t.Errorf("usage = %+v, want %+v", result.Usage, want)
+	}
+	if result.Content != "ok" {
+		t.Errorf("content = %q", result.Content)
+	}
+}
+
+func TestOpenAIStreamChatErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handle  func(w http.ResponseWriter, r *http.Request)
+		wantErr string
+		partial string // 出错前已生成的内容
+	}{
+		{
+			name: "non-200",
+			handle: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"error":{"message":"invalid api key"}}`, http.StatusUnauthorized)
+			},
+			wantErr: "status 401",
+		},
+		{
+			name: "error frame",
+			handle: func(w http.ResponseWriter, r *http.Request) {
+				writeFrames(w,
+					`{"choices":[{"delta":{"content":"par"}}]}`,
+					`{"error":{"message":"rate limited"}}`,
+				)
+			},
+			wantErr: "rate limited",
+			partial: "par",
+		},
+		{
+			name: "malformed frame",
+			handle: func(w http.ResponseWriter, r *http.Request) {
+				writeFrames(w, `{"choices":`)
+			},
+			wantErr: "decode frame",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newOpenAIServer(t, nil, tt.handle)
+			var deltas []string
+			result, err := p.StreamChat(context.Background(), &ChatRequest{}, collectDeltas(&deltas))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if result != nil && result.Content != tt.partial {
+				t.Errorf("partial content = %q, want %q", result.Content, tt.partial)
+			}
+		})
+	}
+}
+
+func TestOpenAIStreamChatCancel(t *testing.T) {
+	p := newOpenAIServer(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		writeFrames(w, `{"choices":[{"delta":{"content":"first"}}]}`)
+		// 上游在客户端取消前不再输出
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var deltas []string
+	result, err := p.StreamChat(ctx, &ChatRequest{}, func(delta string) error {
+		deltas = append(deltas, delta)
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if result.Content != "first" || result.FinishReason != "canceled" {
+		t.Errorf("result = %+v", result)
+	}
+	if !slices.Equal(deltas, []string{"first"}) {
+		t.Errorf("deltas = %q", deltas)
+	}
+}
+
+func TestOpenAIStreamChatHandlerStops(t *testing.T) {
+	p := newOpenAIServer(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		writeFrames(w,
+			`{"choices":[{"delta":{"content":"a"}}]}`,
+			`{"choices":[{"delta":{"content":"b"}}]}`,
+			`[DONE]`,
+		)
+	})
+
+	// 流已中断时回调返回错误，提供方停止读取
+	result, err := p.StreamChat(context.Background(), &ChatRequest{}, func(delta string) error {
+		return context.Canceled
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if result.Content != "" || result.FinishReason != "canceled" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestOpenAIConfigMerge(t *testing.T) {
+	temperature := 0.2
+	defaults := OpenAIConfig{
+		BaseURL:         "https://api.openai.com",
+		Model:           "gpt-test",
+		APIKey:          "sk-server",
+		Temperature:     &temperature,
+		MaxTokens:       512,
+		AllowedBaseURLs: []string{"https://llm.internal/v1", "http://10.0.0.8:8000"},
+	}
+
+	tests := []struct {
+		name    string
+		cfg     map[string]any
+		want    OpenAIConfig
+		wantErr string
+	}{
+		{
+			name: "server defaults",
+			want: defaults,
+		},
+		{
+			name: "same base_url keeps server key",
+			cfg:  map[string]any{ModelCfgBaseURL: "https://api.openai.com/", ModelCfgMaxTokens: 64.0},
+			want: OpenAIConfig{BaseURL: "https://api.openai.com", Model: "gpt-test", APIKey: "sk-server", Temperature: &temperature, MaxTokens: 64},
+		},
+		{
+			name:    "other base_url without api_key",
+			cfg:     map[string]any{ModelCfgBaseURL: "https://llm.internal/v1"},
+			wantErr: "api_key is required",
+		},
+		{
+			name: "allowed base_url with its own api_key",
+			cfg:  map[string]any{ModelCfgBaseURL: "https://llm.internal/v1/", ModelCfgAPIKey: "sk-project", ModelCfgTemperature: "0.9"},
+			want: OpenAIConfig{BaseURL: "https://llm.internal/v1/", Model: "gpt-test", APIKey: "sk-project", Temperature: ptr(0.9), MaxTokens: 512},
+		},
+		{
+			name:    "base_url not in allowlist",
+			cfg:     map[string]any{ModelCfgBaseURL: "http://169.254.169.254", ModelCfgAPIKey: "sk-project"},
+			wantErr: "not allowed",
+		},
+		{
+			name:    "host that only shares a prefix",
+			cfg:     map[string]any{ModelCfgBaseURL: "https://llm.internal.evil.com/v1", ModelCfgAPIKey: "sk-project"},
+			wantErr: "not allowed",
+		},
+		{
+			name:    "path outside the allowed prefix",
+			cfg:     map[string]any{ModelCfgBaseURL: "https://llm.internal/v10", ModelCfgAPIKey: "sk-project"},
+			wantErr: "not allowed",
+		},
+		{
+			name:    "userinfo in base_url",
+			cfg:     map[string]any{ModelCfgBaseURL: "http://user@10.0.0.8:8000", ModelCfgAPIKey: "sk-project"},
+			wantErr: "not allowed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := defaults.merge(tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("merge: %v", err)
+			}
+			if got.BaseURL != tt.want.BaseURL || got.Model != tt.want.Model || got.APIKey != tt.want.APIKey ||
+				got.MaxTokens != tt.want.MaxTokens || *got.Temperature != *tt.want.Temperature {
+				t.Errorf("merge = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/pkg/tokenizer"
+	"strings"
+)
+
+// PromptBuilder 组装发送给模型的结构化消息列表
+// 顺序为：system（项目自定义指令）→ root 到 tail 的历史路径 → 当前用户消息
+type PromptBuilder struct {
+	UserID    string
+	SessionID string
+
+	ctx        context.Context // 所属流的生成上下文，组装过程中调用模型（如生成摘要）随流中断而取消
+	session    *models.Session
+	project    *models.Project
+	messages   *MessageService
+	providers  *ProviderRegistry   // 生成摘要使用的模型提供方
+	tokenizers *tokenizer.Registry // 按模型统计 token 数，裁剪上下文
+}
+
+// NewPromptBuilder 创建 PromptBuilder，加载会话及其所属项目
+// ctx 为所属流的生成上下文，流被中断后组装过程中的模型调用立即取消
+func (s *ChatService) NewPromptBuilder(ctx context.Context, userID, sessionID string) (*PromptBuilder, error) {
+	session, err := s.sessions.GetSessionById(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	b := &PromptBuilder{
+		UserID:     userID,
+		SessionID:  sessionID,
+		ctx:        ctx,
+		session:    session,
+		messages:   s.messages,
+		providers:  s.providers,
+		tokenizers: s.tokenizers,
+	}
+	if session.ProjectID != "" {
+		// 项目查询失败时不阻塞对话，只是没有自定义指令和模型配置
+		if project, err := s.projects.GetProjectById(userID, session.ProjectID); err == nil {
+			b.project = project
+		}
+	}
+	return b, nil
+}
+
+// ModelConfig 项目的模型服务配置，不在项目中时返回 nil
+func (b *PromptBuilder) ModelConfig() models.JSONMap {
+	if b.project == nil {
+		return nil
+	}
+	return b.project.ModelSvcsConfig
+}
+
+// BuildUntil 以已入库的用户消息 userMsgId 作为最后一轮
+func (b *PromptBuilder) BuildUntil(userMsgId string) ([]ChatMessage, error) {
+	history := b.messages.buildHistoryContext(b.SessionID, userMsgId)
+	if len(history) == 0 || history[len(history)-1].Role != constant.RoleUser {
+		return nil, fmt.Errorf("message %s is not a user message in session %s", userMsgId, b.SessionID)
+	}
+	last := history[len(history)-1]
+	current := ChatMessage{
+		Role:    constant.RoleUser,
+		Content: renderUserContent(last.Content, last.Files),
+	}
+	return b.assemble(history[:len(history)-1], current), nil
+}
+
+// assemble system → 摘要 → 窗口内的历史 → 当前用户消息
+func (b *PromptBuilder) assemble(history []models.Message, current ChatMessage) []ChatMessage {
+	fixed := append(b.systemMessages(), current)
+	summary, kept := b.applyContextPolicy(history, fixed)
+
+	messages := b.systemMessages()
+	if summary != "" {
+		messages = append(messages, ChatMessage{Role: constant.RoleSystem, Content: "以下是较早对话的摘要:\n" + summary})
+	}
+	messages = append(messages, kept...)
+	return append(messages, current)
+}
+
+// systemMessages 项目自定义指令作为 system 消息
+func (b *PromptBuilder) systemMessages() []ChatMessage {
+	if b.project == nil || strings.TrimSpace(b.project.CustomInstruction) == "" {
+		return nil
+	}
+	return []ChatMessage{{Role: constant.RoleSystem, Content: b.project.CustomInstruction}}
+}
+
+// filterHistory 只保留用户消息和有内容的助手消息
+func filterHistory(history []models.Message) []models.Message {
+	filtered := make([]models.Message, 0, len(history))
+	for _, msg := range history {
+		switch msg.Role {
+		case constant.RoleUser:
+			filtered = append(filtered, msg)
+		case constant.RoleAssistant:
+			if msg.Content != "" {
+				filtered = append(filtered, msg)
+			}
+		}
+	}
+	return filtered
+}
+
+// historyToChatMessages 把已过滤的历史消息转为模型消息
+func historyToChatMessages(history []models.Message) []ChatMessage {
+	messages := make([]ChatMessage, 0, len(history))
+	for _, msg := range history {
+		content := msg.Content
+		if msg.Role == constant.RoleUser {
+			content = renderUserContent(msg.Content, msg.Files)
+		}
+		messages = append(messages, ChatMessage{Role: msg.Role, Content: content})
+	}
+	return messages
+}
+
+// renderUserContent 在用户问题后附上文件列表
+func renderUserContent(query string, files []models.File) string {
+	if len(files) == 0 {
+		return query
+	}
+	var sb strings.Builder
+	sb.WriteString(query)
+	sb.WriteString("\n\n附件:")
+	for _, f := range files {
+		name := f.Name
+		if name == "" {
+			name = f.FileName
+		}
+		sb.WriteString("\n- ")
+		sb.WriteString(name)
+		if f.Type != "" {
+			sb.WriteString(" (" + f.Type + ")")
+		}
+		if f.URL != "" {
+			sb.WriteString(": " + f.URL)
+		}
+	}
+	return sb.String()
+}
@@ -4,9 +4,79 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"session-management/response"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+)
+
+const (
+	maxFlushInterval = 2 * time.Second
+	maxFlushBytes    = 64 * 1024
 )
 
+// FlushPolicy SSE 推送的合并策略，按客户端请求选择
+// 默认有新chunk立即发送；设置 Interval 后在窗口内积攒chunk合并为一帧，
+// 积攒的内容达到 MaxBytes 时提前发送。流结束时立即发送剩余内容
+type FlushPolicy struct {
+	Interval time.Duration // 合并窗口，0 表示立即发送
+	MaxBytes int           // 提前发送的字节数阈值，0 表示只按时间窗口，只在 Interval > 0 时生效
+}
+
+// flushPolicyFromRequest 从查询参数 flush_interval_ms、flush_bytes 解析合并策略
+func flushPolicyFromRequest(req *restful.Request) (FlushPolicy, error) {
+	var policy FlushPolicy
+	if v := req.QueryParameter("flush_interval_ms"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 || time.Duration(ms)*time.Millisecond > maxFlushInterval {
+			return policy, &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "flush_interval_ms必须在0到2000之间"}
+		}
+		policy.Interval = time.Duration(ms) * time.Millisecond
+	}
+	if v := req.QueryParameter("flush_bytes"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxFlushBytes {
+			return policy, &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "flush_bytes必须在0到65536之间"}
+		}
+		policy.MaxBytes = n
+	}
+	return policy, nil
+}
+
+// hold 积攒的chunk是否还需要等待合并
+func (p FlushPolicy) hold(pending []string, windowExpired bool) bool {
+	if p.Interval <= 0 || windowExpired {
+		return false
+	}
+	if p.MaxBytes <= 0 {
+		return true
+	}
+	size := 0
+	for _, chunk := range pending {
+		size += len(chunk)
+	}
+	return size < p.MaxBytes
+}
+
 func SendSSE(w http.ResponseWriter, f http.Flusher, event string, data map[string]any) {
+	SendSSEWithID(w, f, "", event, data)
+}
+
+// SendSSEComment 发送注释行，EventSource 会忽略，只用于保持连接活跃
+func SendSSEComment(w http.ResponseWriter, f http.Flusher, comment string) {
+	fmt.Fprintf(w, ": %s\n\n", comment)
+	f.Flush()
+}
+
+// SendSSERetry 设置 EventSource 断线后的重连间隔
+func SendSSERetry(w http.ResponseWriter, f http.Flusher, retry time.Duration) {
+	fmt.Fprintf(w, "retry: %d\n\n", retry.Milliseconds())
+	f.Flush()
+}
+
+// SendSSEWithID 发送带 id 字段的事件，客户端重连时通过 Last-Event-ID 带回最后收到的 id
+func SendSSEWithID(w http.ResponseWriter, f http.Flusher, id string, event string, data map[string]any) {
 	// 1. 将数据转换为 JSON
 	jsonBytes, err := json.Marshal(data)
 	if err != nil {
@@ -17,6 +87,9 @@ func SendSSE(w http.ResponseWriter, f http.Flusher, event string, data map[strin
 	}
 
 	// 2. 发送 SSE 格式数据
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
 	fmt.Fprintf(w, "event: %s\n", event)
 	fmt.Fprintf(w, "data: %s\n\n", jsonBytes) // jsonBytes 是 []byte，自动转换为 string
 
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"session-management/config"
+	"session-management/pkg/streambus"
+	"time"
+)
+
+// busTimeout 单次总线操作的超时时间
+const busTimeout = 3 * time.Second
+
+// NewStreamBus 按配置创建流事件总线，默认为进程内实现；bus.type 为 redis 时使用 Redis 总线，
+// 多实例部署时续传和中断可以落在任意实例上
+func NewStreamBus(cfg config.BusConfig, lagWindow int) (streambus.Bus, error) {
+	if cfg.Type != "redis" {
+		return streambus.NewMemoryBus(lagWindow), nil
+	}
+	bus, err := streambus.NewRedisBus(streambus.RedisOptions{
+		Addr:      cfg.Redis.Addr,
+		Password:  cfg.Redis.Password,
+		DB:        cfg.Redis.DB,
+		Prefix:    cfg.Redis.Prefix,
+		OwnerTTL:  cfg.Redis.OwnerTTL,
+		StreamTTL: cfg.Redis.StreamTTL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect redis stream bus: %w", err)
+	}
+	log.Printf("stream bus: redis %s, instance %s", cfg.Redis.Addr, cfg.InstanceID)
+	return bus, nil
+}
+
+// StartStreamBus 监听其它实例转发来的中断请求，中断本实例持有的流
+func (sm *StreamManager) StartStreamBus(ctx context.Context) error {
+	keys, err := sm.bus.BreakRequests(ctx)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for key := range keys {
+			if sm.breakLocal(key, BreakReasonUser) {
+				log.Printf("stream %s broken by remote request", key)
+			}
+		}
+	}()
+	return nil
+}
+
+// publishStreamOpen 声明本实例开始生成该流
+func (sm *StreamManager) publishStreamOpen(stream *StreamState) {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	key := stream.SessionID + "_" + stream.MessageID
+	if err := sm.bus.Open(ctx, key, sm.instanceID); err != nil {
+		log.Printf("stream bus open %s failed: %v", key, err)
+	}
+}
+
+// publishStreamEvent 发布流事件，失败只记录日志，不影响本实例的推送
+func (sm *StreamManager) publishStreamEvent(stream *StreamState, ev streambus.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	key := stream.SessionID + "_" + stream.MessageID
+	if err := sm.bus.Publish(ctx, key, ev); err != nil {
+		log.Printf("stream bus publish %s %s failed: %v", key, ev.Type, err)
+	}
+}
+
+// requestRemoteBreak 流不在本实例时，请求生成所在实例中断
+func (sm *StreamManager) requestRemoteBreak(streamKey string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	err := sm.bus.RequestBreak(ctx, streamKey)
+	if errors.Is(err, streambus.ErrNotFound) {
+		return false, errors.New("stream not found")
+	}
+	if err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// remoteStreamOwner 流正在其它实例上生成时返回该实例标识
+func (sm *StreamManager) remoteStreamOwner(sessionID, messageID string) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	owner, err := sm.bus.Owner(ctx, sessionID+"_"+messageID)
+	if err != nil || owner == sm.instanceID {
+		return "", false
+	}
+	return owner, true
+}
+
+// attachRemoteStream 流正在其它实例上生成时，在本实例建立一个镜像流
+// 镜像流由总线事件驱动，只负责向本实例的客户端推送，不入库
+// 流不在其它实例上生成时返回 nil
+func (sm *StreamManager) attachRemoteStream(sessionID, messageID string) *StreamState {
+	if _, ok := sm.remoteStreamOwner(sessionID, messageID); !ok {
+		return nil
+	}
+	key := sessionID + "_" + messageID
+
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	events, cursor, err := sm.bus.Snapshot(ctx, key)
+	cancel()
+	if err != nil {
+		return nil
+	}
+	// 已经结束的流由chunk日志重放
+	if len(events) > 0 && events[len(events)-1].Terminal() {
+		return nil
+	}
+
+	mirrorCtx, mirrorCancel := context.WithCancel(context.Background())
+	mirror := &StreamState{
+		SessionID: sessionID,
+		MessageID: messageID,
+		Chunks:    make([]string, 0, len(events)),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Clients:   make(map[string]chan struct{}),
+		ctx:       mirrorCtx,
+		cancel:    mirrorCancel,
+		remote:    true,
+	}
+	for _, ev := range events {
+		mirror.applyRemoteChunk(ev)
+	}
+
+	sub, err := sm.bus.Subscribe(mirrorCtx, key, cursor)
+	if err != nil {
+		mirrorCancel()
+		return nil
+	}
+	stream, created := sm.addMirror(key, mirror)
+	if !created {
+		// 并发续传已经建立了镜像，复用已有的
+		mirrorCancel()
+		return stream
+	}
+	go sm.runMirror(key, mirror, sub)
+	return mirror
+}
+
+// applyRemoteChunk 把总线上的chunk事件追加到镜像流，重复的chunk忽略
+func (s *StreamState) applyRemoteChunk(ev streambus.Event) bool {
+	if ev.Type != streambus.EventChunk {
+		return false
+	}
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if ev.ChunkID < len(s.Chunks) || s.IsBreak || s.IsCompleted {
+		return false
+	}
+	s.Chunks = append(s.Chunks, ev.Content)
+	s.FullResponse += ev.Content
+	s.UpdatedAt = time.Now()
+	return true
+}
+
+// runMirror 消费总线事件驱动镜像流，直到生成结束或镜像被清理
+// 订阅在结束事件之后关闭；没有收到完成事件时都按中断处理
+func (sm *StreamManager) runMirror(key string, mirror *StreamState, events <-chan streambus.Event) {
+	final := StreamChunk{IsBreak: true}
+	for ev := range events {
+		switch ev.Type {
+		case streambus.EventChunk:
+			if mirror.applyRemoteChunk(ev) {
+				notifyClients(mirror)
+			}
+		case streambus.EventComplete:
+			final = StreamChunk{IsCompleted: true}
+		}
+	}
+	sm.finishMirror(key, mirror, final)
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"session-management/response"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/google/uuid"
+)
+
+// coalesceMaxBytes 合并发送时单帧内容的最大字节数
+const coalesceMaxBytes = 16 * 1024
+
+// coalesceChunks 从头合并chunk，直到超过 maxBytes，至少合并一个
+// 返回合并的chunk数和合并后的内容
+func coalesceChunks(chunks []string, maxBytes int) (int, string) {
+	if len(chunks) == 1 {
+		return 1, chunks[0]
+	}
+	var sb strings.Builder
+	n := 0
+	for _, chunk := range chunks {
+		if n > 0 && sb.Len()+len(chunk) > maxBytes {
+			break
+		}
+		sb.WriteString(chunk)
+		n++
+	}
+	return n, sb.String()
+}
+
+// fromChunkLatest 不重放历史chunk，connected 事件中携带已生成的完整内容
+const fromChunkLatest = -1
+
+// StreamSink 流事件的输出端，SSE 和 WebSocket 各有实现
+type StreamSink interface {
+	// Send 发送一个事件，id 非空时为该事件最后一个chunk的序号
+	Send(id string, event string, data map[string]any) error
+	// Heartbeat 等待新chunk期间保持连接活跃
+	Heartbeat(data map[string]any) error
+}
+
+// sseSink SSE 输出端
+type sseSink struct {
+	writer         http.ResponseWriter
+	flusher        http.Flusher
+	heartbeatEvent bool // true 时心跳发送 heartbeat 事件，否则发送注释行
+}
+
+func (s *sseSink) Send(id string, event string, data map[string]any) error {
+	SendSSEWithID(s.writer, s.flusher, id, event, data)
+	return nil
+}
+
+func (s *sseSink) Heartbeat(data map[string]any) error {
+	if s.heartbeatEvent {
+		SendSSE(s.writer, s.flusher, "heartbeat", data)
+	} else {
+		SendSSEComment(s.writer, s.flusher, "ping")
+	}
+	return nil
+}
+
+// sseResponse 已校验的 SSE 响应
+// 合并策略和 Flusher 需在保存消息、启动生成之前检查，参数错误时不会留下没有客户端的生成
+type sseResponse struct {
+	req    *restful.Request
+	resp   *restful.Response
+	policy FlushPolicy
+	sink   *sseSink
+}
+
+// newSSEResponse 解析客户端选择的合并策略，确认响应支持流式写入；此时还没有写入任何内容
+func newSSEResponse(req *restful.Request, resp *restful.Response) (*sseResponse, error) {
+	policy, err := flushPolicyFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := resp.ResponseWriter
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		// http.Error(writer, "Streaming unsupported", http.StatusInternalServerError)
+		return nil, &response.BizError{
+			HttpStatus: http.StatusInternalServerError,
+			Code:       500,
+			Msg:        "Streaming unsupported",
+		}
+	}
+
+	// 默认心跳发送注释行，heartbeat=event 时发送 heartbeat 事件，便于 EventSource 感知
+	sink := &sseSink{
+		writer:         writer,
+		flusher:        flusher,
+		heartbeatEvent: req.QueryParameter("heartbeat") == "event",
+	}
+	return &sseResponse{req: req, resp: resp, policy: policy, sink: sink}, nil
+}
+
+// dealStreamResponse 以 SSE 推送流
+// fromChunk >= 0 时先逐个重放该序号及之后的chunk，之前的内容放在 connected 事件的 history 中
+func (sm *StreamManager) dealStreamResponse(stream *StreamState, fromChunk int, sse *sseResponse) error {
+	// 1. 设置 SSE Header
+	writer := sse.resp.ResponseWriter
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	sse.resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// 建议客户端断线后的重连间隔
+	SendSSERetry(writer, sse.sink.flusher, sm.cfg.RetryHint)
+
+	// 监听客户端断开连接；生成卡住由流的空闲超时中断，这里不再单独限时
+	return sm.deliverStream(sse.req.Request.Context(), stream, fromChunk, sse.policy, sse.sink)
+}
+
+// deliverStream 按客户端自己的读取位置把流推送到 sink
+// 直到流结束、客户端在连接期间落后太多、ctx 取消或 sink 写入失败
+func (sm *StreamManager) deliverStream(ctx context.Context, stream *StreamState, fromChunk int, policy FlushPolicy, sink StreamSink) error {
+	// 获取客户端ID，每次请求都生成一个新的ID，防止多个客户端用同一个id同时请求导致数据混乱
+	clientID := uuid.NewString()
+	frameMaxBytes := max(coalesceMaxBytes, policy.MaxBytes)
+
+	// 注册客户端，客户端从 stream.Chunks 中按自己的读取位置读取
+	// 流已经结束（从日志重放）时不会收到通知，读完剩余chunk即结束
+	attachment := sm.RegisterClient(stream, clientID, fromChunk)
+	defer sm.UnregisterClient(stream, clientID)
+	cursor := attachment.FirstChunkID
+
+	// 发送连接成功事件
+	// 告知客户端连接已建立，并返回会话和消息ID信息
+	// next_chunk_id 为接下来第一个 chunk 的序号，history 为它之前的内容
+	if err := sink.Send("", "connected", map[string]any{
+		"message_id":    stream.MessageID,
+		"session_id":    stream.SessionID,
+		"history":       attachment.History,
+		"next_chunk_id": cursor,
+	}); err != nil {
+		return err
+	}
+
+	// 等待期间定时发送心跳，防止代理关闭空闲连接
+	heartbeat := time.NewTicker(sm.cfg.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	// 服务进入停止流程时通知一次，之后继续推送直到流结束
+	restarting := sm.ShuttingDown()
+
+	// 合并窗口：第一个未发送的chunk到达时开始计时
+	var windowTimer *time.Timer
+	var windowC <-chan time.Time
+	windowExpired := false
+	defer func() {
+		if windowTimer != nil {
+			windowTimer.Stop()
+		}
+	}()
+	for {
+		pending, completed, broken := stream.readFrom(cursor)
+
+		// 连接期间新生成的chunk积压太多（客户端读得比生成慢），断开连接，由客户端从 next_chunk_id 续传
+		// 注册时已有的chunk是续传的补发内容，合并发送即可，不算落后；已结束的流只需读完剩余chunk
+		if !completed && !broken {
+			if behind := cursor + len(pending) - max(cursor, attachment.Generated); behind > sm.cfg.LagWindow {
+				log.Printf("client %s lagged %d chunks behind, message %s", clientID, behind, stream.MessageID)
+				return sink.Send("", "lagged", map[string]any{
+					"message_id":    stream.MessageID,
+					"session_id":    stream.SessionID,
+					"next_chunk_id": cursor,
+					"behind":        behind,
+				})
+			}
+		}
+
+		if len(pending) > 0 && !completed && !broken && policy.hold(pending, windowExpired) {
+			// 在合并窗口内继续积攒
+			if windowC == nil {
+				windowTimer = time.NewTimer(policy.Interval)
+				windowC = windowTimer.C
+			}
+		} else {
+			// 多个chunk合并为一帧发送，id 为合并后最后一个chunk的序号，保持单调递增
+			for len(pending) > 0 {
+				n, content := coalesceChunks(pending, frameMaxBytes)
+				if err := sink.Send(strconv.Itoa(cursor+n-1), "chunk", map[string]any{
+					"session_id":     stream.SessionID,
+					"message_id":     stream.MessageID,
+					"chunk_id":       cursor + n - 1,
+					"first_chunk_id": cursor,
+					"content":        content,
+					"is_final":       false,
+				}); err != nil {
+					return err
+				}
+				cursor += n
+				pending = pending[n:]
+			}
+			if windowTimer != nil {
+				windowTimer.Stop()
+				windowTimer, windowC = nil, nil
+			}
+			windowExpired = false
+		}
+
+		// 流已结束且剩余chunk都已发送，发送结束事件
+		if completed || broken {
+			stream.Mu.RLock()
+			fullContent := stream.FullResponse
+			stream.Mu.RUnlock()
+			return sink.Send("", "complete", map[string]any{
+				"message_id":   stream.MessageID,
+				"session_id":   stream.SessionID,
+				"full_content": fullContent,
+				"is_final":     completed,
+				"is_break":     broken,
+			})
+		}
+
+		select {
+		// 有新的chunk或流已结束
+		case <-attachment.Notify:
+
+		// 合并窗口到期
+		case <-windowC:
+			windowExpired = true
+
+		case <-restarting:
+			restarting = nil
+			if err := sink.Send("", "server_restarting", map[string]any{
+				"message_id":    stream.MessageID,
+				"session_id":    stream.SessionID,
+				"next_chunk_id": cursor,
+				"retry_ms":      sm.cfg.RetryHint.Milliseconds(),
+			}); err != nil {
+				return err
+			}
+
+		case <-heartbeat.C:
+			if err := sink.Heartbeat(map[string]any{
+				"message_id":    stream.MessageID,
+				"session_id":    stream.SessionID,
+				"next_chunk_id": cursor,
+			}); err != nil {
+				return err
+			}
+
+		// 监听客户端连接状态
+		case <-ctx.Done():
+			// 客户端断开连接（如关闭浏览器标签页）
+			// 循环退出，触发 defer UnregisterClient
+			log.Println("deal stream chat:  <-ctx.Done()  :", clientID)
+			return nil
+		}
+	}
+}
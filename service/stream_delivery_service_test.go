@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"session-management/config"
+	constant "session-management/const"
+)
+
+// sinkEvent sink 收到的一个事件
+type sinkEvent struct {
+	id    string
+	event string
+	data  map[string]any
+}
+
+// recordingSink 记录所有事件；onSend 不为空时在记录后调用，可用于阻塞模拟慢客户端
+type recordingSink struct {
+	mu     sync.Mutex
+	events []sinkEvent
+	onSend func(ev sinkEvent)
+}
+
+func (s *recordingSink) Send(id string, event string, data map[string]any) error {
+	ev := sinkEvent{id: id, event: event, data: data}
+	s.mu.Lock()
+	s.events = append(s.events, ev)
+	s.mu.Unlock()
+	if s.onSend != nil {
+		s.onSend(ev)
+	}
+	return nil
+}
+
+func (s *recordingSink) Heartbeat(data map[string]any) error { return nil }
+
+// names 按顺序返回事件名，相邻的 chunk 事件合并为一个
+func (s *recordingSink) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for _, ev := range s.events {
+		if ev.event == "chunk" && len(names) > 0 && names[len(names)-1] == "chunk" {
+			continue
+		}
+		names = append(names, ev.event)
+	}
+	return names
+}
+
+// content 所有 chunk 事件内容的拼接
+func (s *recordingSink) content() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sb strings.Builder
+	for _, ev := range s.events {
+		if ev.event == "chunk" {
+			sb.WriteString(ev.data["content"].(string))
+		}
+	}
+	return sb.String()
+}
+
+func testStreamConfig() config.StreamConfig {
+	return config.StreamConfig{
+		LagWindow:         2000,
+		HeartbeatInterval: time.Minute,
+		IdleTimeout:       time.Minute,
+		RetryHint:         time.Second,
+		ChunkLog: config.ChunkLogConfig{
+			FlushInterval: time.Hour,
+			FlushBytes:    1 << 20,
+		},
+	}
+}
+
+// appendChunks 模拟生成：追加chunk并通知客户端
+func appendChunks(stream *StreamState, chunks ...string) {
+	stream.Mu.Lock()
+	for _, chunk := range chunks {
+		stream.Chunks = append(stream.Chunks, chunk)
+		stream.FullResponse += chunk
+	}
+	stream.Mu.Unlock()
+	notifyClients(stream)
+}
+
+func TestDeliverStreamResumeFarBehindFinishedStream(t *testing.T) {
+	sm := NewStreamManager(nil, nil, nil, testStreamConfig(), "test")
+
+	// 从chunk日志重放的已结束的流，chunk 数超过落后窗口
+	n := sm.cfg.LagWindow + 1
+	stream := &StreamState{
+		SessionID:   "s",
+		MessageID:   "m",
+		Clients:     make(map[string]chan struct{}),
+		IsCompleted: true,
+	}
+	var want strings.Builder
+	for i := 0; i < n; i++ {
+		chunk := strconv.Itoa(i) + ","
+		stream.Chunks = append(stream.Chunks, chunk)
+		want.WriteString(chunk)
+	}
+	stream.FullResponse = want.String()
+
+	sink := &recordingSink{}
+	if err := sm.deliverStream(context.Background(), stream, 0, FlushPolicy{}, sink); err != nil {
+		t.Fatalf("deliverStream: %v", err)
+	}
+	if got := strings.Join(sink.names(), " "); got != "connected chunk complete" {
+		t.Fatalf("events = %s, want connected chunk complete", got)
+	}
+	if sink.content() != want.String() {
+		t.Errorf("replayed content does not match the stream")
+	}
+}
+
+func TestDeliverStreamResumeFarBehindLiveStream(t *testing.T) {
+	cfg := testStreamConfig()
+	cfg.LagWindow = 3
+	sm := NewStreamManager(nil, nil, nil, cfg, "test")
+
+	// 生成中的流已有大量chunk，续传时先补发，不算落后
+	stream := sm.GetOrCreateStream("s", "m", "p", "q", false)
+	for i := 0; i < 10; i++ {
+		appendChunks(stream, "x")
+	}
+
+	done := make(chan error, 1)
+	sink := &recordingSink{}
+	go func() { done <- sm.deliverStream(context.Background(), stream, 0, FlushPolicy{}, sink) }()
+
+	waitFor(t, func() bool { return strings.Join(sink.names(), " ") == "connected chunk" })
+	appendChunks(stream, "y")
+	// 只标记终态，不入库
+	sm.finishLocal(stream.Key(), StreamChunk{IsCompleted: true}, constant.MessageStatusCompleted, nil)
+
+	if err := <-done; err != nil {
+		t.Fatalf("deliverStream: %v", err)
+	}
+	if got := strings.Join(sink.names(), " "); got != "connected chunk complete" {
+		t.Fatalf("events = %s, want connected chunk complete", got)
+	}
+	if got := sink.content(); got != strings.Repeat("x", 10)+"y" {
+		t.Errorf("content = %q", got)
+	}
+}
+
+func TestDeliverStreamLaggedWhileAttached(t *testing.T) {
+	cfg := testStreamConfig()
+	cfg.LagWindow = 3
+	sm := NewStreamManager(nil, nil, nil, cfg, "test")
+	stream := sm.GetOrCreateStream("s", "m", "p", "q", false)
+
+	// 客户端在发送第一个chunk时卡住，期间生成了超过窗口的chunk
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	sink := &recordingSink{onSend: func(ev sinkEvent) {
+		if ev.event == "chunk" {
+			once.Do(func() {
+				close(blocked)
+				<-release
+			})
+		}
+	}}
+	done := make(chan error, 1)
+	go func() { done <- sm.deliverStream(context.Background(), stream, 0, FlushPolicy{}, sink) }()
+
+	waitFor(t, func() bool { return len(sink.names()) == 1 })
+	appendChunks(stream, "a")
+	<-blocked
+	appendChunks(stream, "b", "c", "d", "e")
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("deliverStream: %v", err)
+	}
+	if got := strings.Join(sink.names(), " "); got != "connected chunk lagged" {
+		t.Fatalf("events = %s, want connected chunk lagged", got)
+	}
+	last := sink.events[len(sink.events)-1]
+	if last.data["next_chunk_id"] != 1 || last.data["behind"] != 4 {
+		t.Errorf("lagged event = %v, want next_chunk_id 1, behind 4", last.data)
+	}
+}
+
+// waitFor 等待条件成立，超时视为失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"log"
+	"session-management/config"
+	"time"
+)
+
+// StartStreamJanitor 按 stream.janitor 配置启动流清理，每个周期扫描一次管理器，ctx 取消后停止
+func (sm *StreamManager) StartStreamJanitor(ctx context.Context) {
+	cfg := sm.cfg.Janitor
+	if cfg.AbandonedTTL <= 0 {
+		cfg.AbandonedTTL = sm.cfg.IdleTimeout
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sm.sweep(cfg, time.Now())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// sweep 清理一次：
+// 超过空闲超时的生成中的流按中断处理并入库；
+// 结束超过 CompletedTTL 的流确认终态已入库后删除chunk日志并移出内存
+func (sm *StreamManager) sweep(cfg config.JanitorConfig, now time.Time) {
+	var abandoned, expired []*StreamState
+	sm.Mu.RLock()
+	for _, stream := range sm.Streams {
+		if stream.finished {
+			if now.Sub(stream.finishedAt) > cfg.CompletedTTL {
+				expired = append(expired, stream)
+			}
+			continue
+		}
+		stream.Mu.RLock()
+		timeout := stream.IdleTimeout
+		if timeout <= 0 {
+			timeout = cfg.AbandonedTTL
+		}
+		stale := now.Sub(stream.UpdatedAt) > timeout
+		stream.Mu.RUnlock()
+		if stale {
+			abandoned = append(abandoned, stream)
+		}
+	}
+	sm.Mu.RUnlock()
+
+	for _, stream := range abandoned {
+		if stream.remote {
+			sm.finishMirror(stream.Key(), stream, StreamChunk{IsBreak: true})
+			continue
+		}
+		if sm.breakLocal(stream.Key(), BreakReasonIdle) {
+			log.Printf("stream %s abandoned, marked interrupted", stream.Key())
+		}
+	}
+
+	for _, stream := range expired {
+		if !stream.remote {
+			if !sm.finalizeStream(stream) {
+				// 入库失败，留到下个周期重试
+				continue
+			}
+			// 终态已入库，之后的续传从消息内容读取，不再需要chunk日志
+			if err := sm.messages.deleteChunkLogs(stream.SessionID, stream.MessageID); err != nil {
+				log.Printf("stream %s: delete chunk logs failed: %v", stream.Key(), err)
+				continue
+			}
+		}
+		sm.evict(stream)
+	}
+}
+
+// finalizeStream 确认流的终态已写入消息，之前入库失败时重试
+// 生成方仍在写入时（如 completed_ttl 为 0）返回 false，不会重复写入，下个周期再确认
+func (sm *StreamManager) finalizeStream(stream *StreamState) bool {
+	return sm.persistStreamResult(stream)
+}
+
+// evict 把已结束的流移出管理器，同 key 已被新流替换时不做处理
+func (sm *StreamManager) evict(stream *StreamState) {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	if sm.Streams[stream.Key()] == stream {
+		delete(sm.Streams, stream.Key())
+	}
+}
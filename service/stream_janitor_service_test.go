@@ -0,0 +1,70 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"session-management/config"
+	constant "session-management/const"
+	"session-management/models"
+)
+
+func TestSweepWaitsForInFlightPersist(t *testing.T) {
+	chat, messages := newTestChatService(t)
+	sm := chat.streams
+	stream := sm.GetOrCreateStream("s", "m", "u", "hello", false)
+	stream.Mu.Lock()
+	stream.FullResponse = "partial"
+	stream.Mu.Unlock()
+
+	extra := models.JSONMap{"break": true, "break_reason": BreakReasonIdle}
+	if _, ok := sm.finishLocal(stream.Key(), StreamChunk{IsBreak: true}, constant.MessageStatusInterrupted, extra); !ok {
+		t.Fatal("finishLocal: stream not finished")
+	}
+	if _, ok := sm.finishLocal(stream.Key(), StreamChunk{IsCompleted: true}, constant.MessageStatusCompleted, nil); ok {
+		t.Fatal("finishLocal twice: want false")
+	}
+
+	// 生成方还在写入终态时，completed_ttl 为 0 的 janitor 不重复写入，也不移除流
+	stream.Mu.Lock()
+	stream.persisting = true
+	stream.Mu.Unlock()
+	janitor := config.JanitorConfig{CompletedTTL: 0}
+	sm.sweep(janitor, time.Now().Add(time.Second))
+	if msg, err := messages.GetMessageById("s", "m"); err != nil || msg.Status != constant.MessageStatusProcessing {
+		t.Fatalf("message during persist = %+v, %v, want still processing", msg, err)
+	}
+	if len(sm.ListStreams("s")) != 1 {
+		t.Fatal("stream evicted while persisting")
+	}
+
+	stream.Mu.Lock()
+	stream.persisting = false
+	stream.Mu.Unlock()
+	if !sm.persistStreamResult(stream) {
+		t.Fatal("persistStreamResult: want true")
+	}
+	msg, err := messages.GetMessageById("s", "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 终态只来自 finishLocal
+	if msg.Status != constant.MessageStatusInterrupted || msg.Content != "partial" || msg.Metadata["break_reason"] != BreakReasonIdle {
+		t.Fatalf("persisted message = %+v", msg)
+	}
+
+	// 已入库后不再写入
+	if err := messages.db.Model(&models.Message{ID: "m"}).Update("content", "edited").Error; err != nil {
+		t.Fatal(err)
+	}
+	if !sm.persistStreamResult(stream) {
+		t.Error("persistStreamResult after persisting: want true")
+	}
+	sm.sweep(janitor, time.Now().Add(time.Second))
+	if msg, _ := messages.GetMessageById("s", "m"); msg.Content != "edited" {
+		t.Errorf("message rewritten after persisting: %q", msg.Content)
+	}
+	if len(sm.ListStreams("s")) != 0 {
+		t.Error("persisted stream not evicted")
+	}
+}
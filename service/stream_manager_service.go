@@ -1,31 +1,69 @@
 package service
 
 import (
-	"errors"
+	"context"
 	"log"
+	"session-management/config"
 	constant "session-management/const"
 	my_models "session-management/models"
+	"session-management/pkg/streambus"
+	"session-management/pkg/tokenizer"
+	"session-management/response"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 // StreamState 流式生成状态
 type StreamState struct {
-	SessionID    string                      `json:"session_id"`    // 会话ID
-	MessageID    string                      `json:"message_id"`    // 消息ID
-	ParentID     *string                     `json:"parent_id"`     // 父消息ID
-	Query        string                      `json:"query"`         // 用户查询
-	Steps        []my_models.StepNode        `json:"steps"`         // 所有步骤
-	Files        []my_models.File            `json:"files"`         // 所有文件
-	FullResponse string                      `json:"full_response"` // 完整响应（逐步构建）
-	Chunks       []string                    `json:"chunks"`        // 所有chunk
-	IsBreak      bool                        `json:"is_break"`      // 是否中断
-	IsCompleted  bool                        `json:"is_completed"`  // 是否完成
-	CreatedAt    time.Time                   `json:"created_at"`    // 创建时间
-	UpdatedAt    time.Time                   `json:"updated_at"`    // 更新时间
-	Clients      map[string]chan StreamChunk // 连接的客户端
-	Mu           sync.RWMutex                `json:"-"` // 添加互斥锁
+	SessionID    string                   `json:"session_id"`    // 会话ID
+	MessageID    string                   `json:"message_id"`    // 消息ID
+	ParentID     *string                  `json:"parent_id"`     // 父消息ID
+	Query        string                   `json:"query"`         // 用户查询
+	Steps        []my_models.StepNode     `json:"steps"`         // 所有步骤
+	Files        []my_models.File         `json:"files"`         // 所有文件
+	FullResponse string                   `json:"full_response"` // 完整响应（逐步构建）
+	Chunks       []string                 `json:"chunks"`        // 所有chunk
+	Model        string                   `json:"model"`         // 生成所用模型
+	Usage        *Usage                   `json:"usage"`         // 模型返回的 token 用量
+	PromptTokens int                      `json:"prompt_tokens"` // 本地统计的 prompt token 数
+	IdleTimeout  time.Duration            `json:"idle_timeout"`  // 超过该时间没有新chunk时中断
+	Metadata     my_models.JSONMap        `json:"metadata"`      // 助手消息创建时的元信息，入库时保留
+	IsBreak      bool                     `json:"is_break"`      // 是否中断
+	IsCompleted  bool                     `json:"is_completed"`  // 是否完成
+	CreatedAt    time.Time                `json:"created_at"`    // 创建时间
+	UpdatedAt    time.Time                `json:"updated_at"`    // 更新时间
+	Clients      map[string]chan struct{} // 连接的客户端，有新chunk或流结束时收到信号
+	Mu           sync.RWMutex             `json:"-"` // 添加互斥锁
+
+	ctx      context.Context    // 生成上下文，由管理器持有，流结束时取消
+	cancel   context.CancelFunc // 取消生成
+	remote   bool               // 镜像流：生成在其它实例上，本实例只转发总线事件
+	chunkLog *chunkLogWriter    // 批量写入chunk日志，镜像流和只推送不入库时为 nil
+
+	// 以下字段由 sm.Mu 保护：结束的流留在管理器中供续传，由 janitor 按 TTL 移除
+	finished   bool      // 已进入终态
+	finishedAt time.Time // 进入终态的时间
+
+	// 以下字段由 Mu 保护：终态由 finishLocal 记录，入库失败时由 janitor 在移除前重试
+	finalStatus string            // 终态对应的消息状态
+	finalExtra  my_models.JSONMap // 终态附加的元信息
+	persisting  bool              // 正在写入终态，其它调用方不再重复写入
+	persisted   bool              // 终态是否已写入消息
+}
+
+// Key 流在管理器中的 key：sessionID_messageID
+func (s *StreamState) Key() string {
+	return s.SessionID + "_" + s.MessageID
+}
 
+// Context 生成所用的上下文，流被中断或清理后取消
+func (s *StreamState) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
 }
 
 // StreamChunk 流式chunk
@@ -42,24 +80,63 @@ type StreamChunk struct {
 type StreamManager struct {
 	Streams map[string]*StreamState // sessionID_messageID -> StreamState
 	Mu      sync.RWMutex
+
+	messages   *MessageService     // 流结束时写入助手消息
+	bus        streambus.Bus       // 跨实例的流事件总线
+	busChunks  bool                // 是否向总线发布chunk事件，进程内总线没有镜像流，不发布
+	tokenizers *tokenizer.Registry // 模型没有返回用量时统计 token 数
+	cfg        config.StreamConfig // 流式生成与推送配置
+	instanceID string              // 当前实例标识，用于判断流是否由本实例生成
+
+	shutdownCh   chan struct{} // 进入停止流程后关闭
+	shutdownOnce sync.Once
 }
 
-var GlobalStreamManager = StreamManager{
-	Streams: make(map[string]*StreamState),
+// 创建流状态管理器，bus 为 nil 时使用进程内总线，tokenizers 为 nil 时使用启发式分词器
+func NewStreamManager(messages *MessageService, bus streambus.Bus, tokenizers *tokenizer.Registry, cfg config.StreamConfig, instanceID string) *StreamManager {
+	if bus == nil {
+		bus = streambus.NewMemoryBus(cfg.LagWindow)
+	}
+	_, inProcess := bus.(*streambus.MemoryBus)
+	if tokenizers == nil {
+		tokenizers = tokenizer.NewRegistry(nil)
+	}
+	return &StreamManager{
+		Streams:    make(map[string]*StreamState),
+		messages:   messages,
+		bus:        bus,
+		busChunks:  !inProcess,
+		tokenizers: tokenizers,
+		cfg:        cfg,
+		instanceID: instanceID,
+		shutdownCh: make(chan struct{}),
+	}
+}
+
+// StreamCfgIdleTimeout 项目模型配置中的流空闲超时（秒）
+const StreamCfgIdleTimeout = "idle_timeout_seconds"
+
+// idleTimeoutFor 项目模型配置中的空闲超时，未配置时使用 stream.idle_timeout
+func (sm *StreamManager) idleTimeoutFor(cfg my_models.JSONMap) time.Duration {
+	if seconds, ok := jsonMapFloat(cfg, StreamCfgIdleTimeout); ok && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return sm.cfg.IdleTimeout
 }
 
 // 获取或创建流状态
 func (sm *StreamManager) GetOrCreateStream(sessionID, assistMsgID, parentID, query string, resume bool) *StreamState {
-	// 清理过期流，自定义过期时间
-	go sm.cleanupExpiredStreams()
 	// 若是恢复流，直接返回
 	if resume {
+		sm.Mu.RLock()
+		defer sm.Mu.RUnlock()
 		return sm.Streams[sessionID+"_"+assistMsgID]
 	}
 	sm.Mu.Lock()
 	defer sm.Mu.Unlock()
 
 	// 说明是创建新流
+	ctx, cancel := context.WithCancel(context.Background())
 	stream := &StreamState{
 		SessionID:    sessionID,
 		MessageID:    assistMsgID,
@@ -70,7 +147,10 @@ func (sm *StreamManager) GetOrCreateStream(sessionID, assistMsgID, parentID, que
 		IsCompleted:  false,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
-		Clients:      make(map[string]chan StreamChunk),
+		Clients:      make(map[string]chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+		chunkLog:     sm.newChunkLogWriter(sessionID, assistMsgID),
 	}
 
 	sm.Streams[sessionID+"_"+assistMsgID] = stream
@@ -78,167 +158,320 @@ func (sm *StreamManager) GetOrCreateStream(sessionID, assistMsgID, parentID, que
 	return stream
 }
 
-// 添加chunk到流
-func (sm *StreamManager) AddChunk(streamState *StreamState, chunk string) {
+// 标记流完成，流不存在（已被中断或清理）时不做任何处理
+func (sm *StreamManager) CompleteStream(streamKey string) {
+	stream, ok := sm.finishLocal(streamKey, StreamChunk{IsCompleted: true}, constant.MessageStatusCompleted, nil)
+	if !ok {
+		return
+	}
+
+	//消息入库
+	log.Printf("CompleteStream，最终消息入库: %s", stream.MessageID)
+	sm.persistStreamResult(stream)
+}
+
+// finishLocal 结束本实例生成的流并记录终态，返回流以及是否由这次调用结束
+// 只在 sm.Mu 内标记终态，总线发布和入库由调用方在锁外进行，不阻塞其它流的创建、续传和查询
+func (sm *StreamManager) finishLocal(streamKey string, final StreamChunk, status string, extra my_models.JSONMap) (*StreamState, bool) {
 	sm.Mu.Lock()
-	defer sm.Mu.Unlock()
+	stream, exists := sm.Streams[streamKey]
+	if !exists || stream.remote || stream.finished {
+		sm.Mu.Unlock()
+		return nil, false
+	}
+	sm.finishLocked(streamKey, stream, final)
+	// 入库之前先记下终态，persistStreamResult 和 janitor 的重试都按此写入
+	stream.Mu.Lock()
+	stream.finalStatus = status
+	stream.finalExtra = extra
+	stream.Mu.Unlock()
+	sm.Mu.Unlock()
+
+	// 写入剩余的chunk日志，此后生成回调不会再追加chunk
+	stream.chunkLog.close()
+
+	// 通知其它实例上的镜像
+	ev := streambus.Event{Type: streambus.EventComplete}
+	if final.IsBreak {
+		ev.Type = streambus.EventBreak
+	}
+	sm.publishStreamEvent(stream, ev)
+	return stream, true
+}
 
-	if stream, exists := sm.Streams[streamState.SessionID+"_"+streamState.MessageID]; exists {
-		stream.Chunks = append(stream.Chunks, chunk)
-		stream.FullResponse += chunk
-		stream.UpdatedAt = time.Now()
+// 中断原因，记录在消息元信息的 break_reason 中
+const (
+	BreakReasonUser     = "user"         // 用户或管理员中断
+	BreakReasonError    = "error"        // 生成出错
+	BreakReasonIdle     = "idle_timeout" // 超过空闲时间没有新chunk
+	BreakReasonShutdown = "shutdown"     // 服务停止
+)
+
+// persistStreamResult 把 finishLocal 记录的终态连同最终内容、用量写入助手消息，返回终态是否已入库
+// 同一时刻只有一个调用方写入：已入库或没有终态时直接返回 true，其它调用方正在写入时返回 false，由 janitor 下个周期再确认
+func (sm *StreamManager) persistStreamResult(stream *StreamState) bool {
+	stream.Mu.Lock()
+	if stream.persisted || stream.finalStatus == "" {
+		stream.Mu.Unlock()
+		return true
+	}
+	if stream.persisting {
+		stream.Mu.Unlock()
+		return false
+	}
+	stream.persisting = true
+	status, extra := stream.finalStatus, stream.finalExtra
+	promptTokens, completionTokens := streamTokenCounts(sm.tokenizers, stream)
+	metadata := my_models.JSONMap{}
+	for k, v := range stream.Metadata {
+		metadata[k] = v
+	}
+	metadata["model"] = stream.Model
+	if stream.Usage != nil {
+		metadata["usage"] = stream.Usage
+	}
+	for k, v := range extra {
+		metadata[k] = v
+	}
+	msg := &my_models.Message{
+		ID:               stream.MessageID,
+		Content:          stream.FullResponse,
+		TokenCount:       completionTokens,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Status:           status,
+		Metadata:         metadata,
 	}
+	stream.Mu.Unlock()
+
+	err := sm.messages.updateMessageResult(msg)
+	if err != nil {
+		log.Printf("updateMessageResult failed: %v", err)
+	}
+	stream.Mu.Lock()
+	defer stream.Mu.Unlock()
+	stream.persisting = false
+	stream.persisted = err == nil
+	return stream.persisted
 }
 
-// 标记流完成
-func (sm *StreamManager) CompleteStream(streamKey string) {
-	sm.Mu.Lock()
-	defer sm.Mu.Unlock()
+// finishLocked 结束流：取消生成、标记终态并通知所有客户端
+// 调用方需持有 sm.Mu 并确认流尚未结束，因此终态只入库一次；不做任何 IO，总线发布由调用方在锁外进行
+// 结束的流仍留在管理器中，续传直接从内存读取，由 janitor 过期后移除
+func (sm *StreamManager) finishLocked(streamKey string, stream *StreamState, final StreamChunk) {
+	stream.finished = true
+	stream.finishedAt = time.Now()
+	if stream.cancel != nil {
+		stream.cancel()
+	}
 
-	if stream, exists := sm.Streams[streamKey]; exists {
-		stream.IsCompleted = true
-		stream.UpdatedAt = time.Now()
+	// 在 stream.Mu 内标记终态，此后生成回调不会再追加chunk
+	stream.Mu.Lock()
+	stream.IsCompleted = final.IsCompleted
+	stream.IsBreak = final.IsBreak
+	stream.UpdatedAt = time.Now()
+	stream.Mu.Unlock()
 
-		// 通知所有客户端完成
-		for clientID, ch := range stream.Clients {
-			ch <- StreamChunk{IsCompleted: true}
-			close(ch)
-			delete(stream.Clients, clientID)
-		}
-		//消息入库
-		log.Printf("CompleteStream，最终消息入库: %s", stream.MessageID)
-		if err := updateMessageFields(stream.MessageID, map[string]any{
-			"content":     stream.FullResponse,
-			"token_count": len(stream.FullResponse),
-			"status":      constant.MessageStatusCompleted,
-		}); err != nil {
-			log.Printf("updateMessageFields failed: %v", err)
-		}
-		//删除流
-		delete(sm.Streams, streamKey)
+	// 客户端读完剩余的chunk后自行发送结束事件
+	notifyClients(stream)
+}
 
+// addMirror 登记镜像流，已有同 key 的流时返回已有的
+func (sm *StreamManager) addMirror(streamKey string, mirror *StreamState) (*StreamState, bool) {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	if existing, ok := sm.Streams[streamKey]; ok {
+		return existing, false
 	}
+	sm.Streams[streamKey] = mirror
+	return mirror, true
+}
 
+// finishMirror 结束镜像流，只通知本实例的客户端，入库由生成所在实例负责
+func (sm *StreamManager) finishMirror(streamKey string, mirror *StreamState, final StreamChunk) {
+	sm.Mu.Lock()
+	defer sm.Mu.Unlock()
+	if sm.Streams[streamKey] != mirror || mirror.finished {
+		return
+	}
+	sm.finishLocked(streamKey, mirror, final)
+}
+
+// ClientAttachment 客户端注册结果
+type ClientAttachment struct {
+	Notify       <-chan struct{} // 有新chunk或流结束时收到信号，流已结束时为 nil
+	History      string          // FirstChunkID 之前已生成的内容
+	FirstChunkID int             // 客户端读取的起点
+	Generated    int             // 注册时已生成的chunk数，之前的内容为补发，不计入落后量
 }
 
 // 客户端注册监听
-func (sm *StreamManager) RegisterClient(stream *StreamState, clientID string) <-chan StreamChunk {
+// fromChunk >= 0 时从该序号开始读取；为负数时从当前位置开始，之前的内容放在 History 中
+// 客户端自己维护读取位置，从 stream.Chunks 中读取，不会因为读得慢而丢chunk
+func (sm *StreamManager) RegisterClient(stream *StreamState, clientID string, fromChunk int) ClientAttachment {
+	stream.Mu.Lock()
+	defer stream.Mu.Unlock()
+
+	start := fromChunk
+	if start < 0 || start > len(stream.Chunks) {
+		start = len(stream.Chunks)
+	}
+	attachment := ClientAttachment{
+		History:      strings.Join(stream.Chunks[:start], ""),
+		FirstChunkID: start,
+		Generated:    len(stream.Chunks),
+	}
+
+	// 如果流已结束，只需要读取剩余的chunk
+	if stream.IsCompleted || stream.IsBreak {
+		return attachment
+	}
+
 	ch := stream.Clients[clientID]
 	if ch == nil {
-		ch = make(chan StreamChunk, 100)
+		ch = make(chan struct{}, 1)
 		stream.Clients[clientID] = ch
 	}
-
-	// 如果流已完成，立即发送完成信号
-	if stream.IsCompleted {
-		go func() {
-			ch <- StreamChunk{IsCompleted: true}
-			close(ch)
-		}()
-		return nil
-	}
-	return ch
+	attachment.Notify = ch
+	return attachment
 
 }
 
-// 客户端注销
-func (sm *StreamManager) UnregisterClient(sessionID, clientID string) {
-	sm.Mu.Lock()
-	defer sm.Mu.Unlock()
+// notifyClients 通知所有客户端有新的chunk或流已结束
+// 信号通道容量为 1，客户端还没处理上一个信号时不重复发送，读取时会一并读到
+func notifyClients(stream *StreamState) {
+	stream.Mu.RLock()
+	defer stream.Mu.RUnlock()
 
-	if stream, exists := sm.Streams[sessionID]; exists {
-		if ch, exists := stream.Clients[clientID]; exists {
-			close(ch)
-			delete(stream.Clients, clientID)
+	for _, ch := range stream.Clients {
+		select {
+		case ch <- struct{}{}:
+		default:
 		}
 	}
 }
 
-// 获取未完成的chunks
-func (sm *StreamManager) GetPendingChunks(messageID string) []StreamChunk {
+// readFrom 读取 cursor 及之后已生成的chunk，以及流是否已结束
+// chunk 只会追加不会修改，返回的切片可以在锁外使用
+func (s *StreamState) readFrom(cursor int) (chunks []string, completed, broken bool) {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+	if cursor < len(s.Chunks) {
+		chunks = s.Chunks[cursor:len(s.Chunks):len(s.Chunks)]
+	}
+	return chunks, s.IsCompleted, s.IsBreak
+}
+
+// localStreamCount 本实例生成中的流数量，不含镜像流和已结束的流
+func (sm *StreamManager) localStreamCount() int {
 	sm.Mu.RLock()
 	defer sm.Mu.RUnlock()
-
-	if stream, exists := sm.Streams[messageID]; exists && !stream.IsCompleted {
-		var pending []StreamChunk
-		for i := 0; i < len(stream.Chunks); i++ {
-			pending = append(pending, StreamChunk{
-				ChunkID:     i,
-				Content:     stream.Chunks[i],
-				IsCompleted: false,
-			})
+	n := 0
+	for _, stream := range sm.Streams {
+		if !stream.remote && !stream.finished {
+			n++
 		}
-		log.Printf("GetPendingChunks: %s, %d, stream:%v", messageID, len(pending), stream)
+	}
+	return n
+}
 
-		return pending
+// breakAll 中断本实例上的所有流，镜像流只结束本实例的客户端
+// 返回中断的本实例生成的流数量
+func (sm *StreamManager) breakAll(reason string) int {
+	sm.Mu.RLock()
+	streams := make([]*StreamState, 0, len(sm.Streams))
+	for _, stream := range sm.Streams {
+		if !stream.finished {
+			streams = append(streams, stream)
+		}
 	}
+	sm.Mu.RUnlock()
 
-	return nil
+	n := 0
+	for _, stream := range streams {
+		if stream.remote {
+			sm.finishMirror(stream.Key(), stream, StreamChunk{IsBreak: true})
+			continue
+		}
+		if sm.breakLocal(stream.Key(), reason) {
+			n++
+		}
+	}
+	return n
 }
 
-// 清理过期流，自定义过期时间
-func (sm *StreamManager) cleanupExpiredStreams() {
-	sm.Mu.Lock()
-	defer sm.Mu.Unlock()
-
-	cutoff := time.Now().Add(-10 * time.Minute)
-	for streamKey, stream := range sm.Streams {
-		if stream.UpdatedAt.Before(cutoff) {
-			for clientID, ch := range stream.Clients {
-				close(ch)
-				delete(stream.Clients, clientID)
-			}
-			delete(sm.Streams, streamKey)
+// ListStreams 本实例上的流状态，按创建时间升序；sessionID 为空时返回全部
+func (sm *StreamManager) ListStreams(sessionID string) []response.StreamStatus {
+	sm.Mu.RLock()
+	streams := make([]*StreamState, 0, len(sm.Streams))
+	for _, stream := range sm.Streams {
+		if sessionID == "" || stream.SessionID == sessionID {
+			streams = append(streams, stream)
 		}
 	}
+	sm.Mu.RUnlock()
+
+	now := time.Now()
+	statuses := make([]response.StreamStatus, 0, len(streams))
+	for _, stream := range streams {
+		stream.Mu.RLock()
+		statuses = append(statuses, response.StreamStatus{
+			SessionID:   stream.SessionID,
+			MessageID:   stream.MessageID,
+			Instance:    sm.instanceID,
+			Remote:      stream.remote,
+			ChunkCount:  len(stream.Chunks),
+			ClientCount: len(stream.Clients),
+			AgeSeconds:  int64(now.Sub(stream.CreatedAt).Seconds()),
+			IsBreak:     stream.IsBreak,
+			IsCompleted: stream.IsCompleted,
+			CreatedAt:   stream.CreatedAt,
+			UpdatedAt:   stream.UpdatedAt,
+		})
+		stream.Mu.RUnlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].CreatedAt.Before(statuses[j].CreatedAt)
+	})
+	return statuses
+}
+
+// ListAllStreams 管理接口：查询本实例上的所有流
+func (sm *StreamManager) ListAllStreams() *response.ListStreamsResponse {
+	streams := sm.ListStreams("")
+	return &response.ListStreamsResponse{Count: len(streams), Streams: streams}
 }
 
-// BreakStream 中断流，通知所有客户端中断，关闭流
+// 客户端注销，客户端断开或结束读取时调用
+func (sm *StreamManager) UnregisterClient(stream *StreamState, clientID string) {
+	stream.Mu.Lock()
+	defer stream.Mu.Unlock()
+	delete(stream.Clients, clientID)
+}
+
+// BreakStream 中断流，取消生成，通知所有客户端中断，关闭流
+// 流在其它实例上生成时，通过总线请求该实例中断
 // 返回是否存在该流，是否成功中断
 func (sm *StreamManager) BreakStream(sessionID, messageID string) (bool, error) {
-	sm.Mu.Lock()
-	defer sm.Mu.Unlock()
-
 	streamKey := sessionID + "_" + messageID
-
-	if stream, exists := sm.Streams[streamKey]; exists {
-		stream.IsBreak = true
-		stream.UpdatedAt = time.Now()
-
-		// 通知所有客户端中断
-		for clientID, ch := range stream.Clients {
-			ch <- StreamChunk{IsBreak: true}
-			close(ch)
-			delete(stream.Clients, clientID)
-		}
-		//删除流
-		delete(sm.Streams, streamKey)
-
-		//消息入库
-		msg := &my_models.Message{
-			ID:         stream.MessageID,
-			SessionID:  stream.SessionID,
-			ParentID:   stream.ParentID,
-			Role:       constant.RoleAssistant,
-			Steps:      stream.Steps,
-			Files:      stream.Files,
-			Content:    stream.FullResponse,
-			TokenCount: len(stream.FullResponse),
-			CreatedAt:  stream.CreatedAt,
-			UpdatedAt:  time.Now(),
-			Status:     constant.MessageStatusInterrupted,
-			Deleted:    false,
-			Extension:  nil,
-			Metadata: map[string]any{
-				"model": "mock_llm",
-				"break": true,
-			},
-		}
-		if err := updateMessageById(msg); err != nil {
-			log.Printf("updateMessageById failed: %v", err)
-		}
-
+	if sm.breakLocal(streamKey, BreakReasonUser) {
 		return true, nil
 	}
-	return false, errors.New("stream not found")
+	return sm.requestRemoteBreak(streamKey)
+}
+
+// breakLocal 中断本实例生成的流并入库，流不在本实例生成时返回 false
+func (sm *StreamManager) breakLocal(streamKey, reason string) bool {
+	extra := my_models.JSONMap{
+		"break":        true,
+		"break_reason": reason,
+	}
+	stream, ok := sm.finishLocal(streamKey, StreamChunk{IsBreak: true}, constant.MessageStatusInterrupted, extra)
+	if !ok {
+		return false
+	}
+
+	//消息入库
+	sm.persistStreamResult(stream)
+	return true
 }
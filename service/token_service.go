@@ -0,0 +1,88 @@
+package service
+
+import (
+	"log"
+	"session-management/models"
+	"session-management/pkg/tokenizer"
+	"session-management/response"
+)
+
+// countTokens 按模型对应的分词器统计文本 token 数
+func countTokens(tokenizers *tokenizer.Registry, model string, text string) int {
+	return tokenizers.ForModel(model).Count(text)
+}
+
+// countPromptTokens 统计一组模型消息的 token 数，含每条消息的格式开销
+func countPromptTokens(tokenizers *tokenizer.Registry, model string, messages []ChatMessage) int {
+	t := tokenizers.ForModel(model)
+	total := 0
+	for _, msg := range messages {
+		total += messageTokens(t, msg)
+	}
+	return total
+}
+
+// streamTokenCounts 流结束时的 prompt/completion token 数，优先使用模型返回的用量
+func streamTokenCounts(tokenizers *tokenizer.Registry, stream *StreamState) (promptTokens, completionTokens int) {
+	if stream.Usage != nil {
+		return stream.Usage.PromptTokens, stream.Usage.CompletionTokens
+	}
+	return stream.PromptTokens, countTokens(tokenizers, stream.Model, stream.FullResponse)
+}
+
+// GetSessionTokenUsage 统计会话的 token 用量
+func (s *SessionService) GetSessionTokenUsage(userID, sessionID string) (*response.TokenUsageResponse, error) {
+	if _, err := s.GetSessionById(userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	var usage response.TokenUsageResponse
+	err := s.db.Model(&models.Message{}).
+		Select("COUNT(*) AS message_count, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, "+
+			"COALESCE(SUM(completion_tokens), 0) AS completion_tokens").
+		Where("session_id = ? AND deleted = ?", sessionID, false).
+		Scan(&usage).Error
+	if err != nil {
+		return nil, response.WrapError(500, "统计会话用量失败", err)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return &usage, nil
+}
+
+// GetProjectTokenUsage 统计项目下所有会话的 token 用量
+func (s *ProjectService) GetProjectTokenUsage(userID, projectID string) (*response.TokenUsageResponse, error) {
+	if _, err := s.GetProjectById(userID, projectID); err != nil {
+		return nil, err
+	}
+
+	var usage response.TokenUsageResponse
+	err := s.db.Model(&models.Message{}).
+		Select("COUNT(*) AS message_count, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, "+
+			"COALESCE(SUM(completion_tokens), 0) AS completion_tokens").
+		Where("deleted = ? AND session_id IN (?)", false,
+			s.db.Model(&models.Session{}).Select("id").
+				Where("project_id = ? AND user_id = ? AND deleted = ?", projectID, userID, false)).
+		Scan(&usage).Error
+	if err != nil {
+		return nil, response.WrapError(500, "统计项目用量失败", err)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return &usage, nil
+}
+
+// NewTokenizerRegistry 创建分词器注册表，path 为本地 BPE 词表，作为默认分词器
+// path 为空或加载失败时使用启发式分词器，加载失败只记录日志
+func NewTokenizerRegistry(path string) *tokenizer.Registry {
+	tokenizers := tokenizer.NewRegistry(nil)
+	if path == "" {
+		return tokenizers
+	}
+	bpe, err := tokenizer.LoadBPEFile("bpe", path)
+	if err != nil {
+		log.Printf("load tokenizer vocab %s failed, fallback to heuristic: %v", path, err)
+		return tokenizers
+	}
+	tokenizers.SetDefault(bpe)
+	log.Printf("tokenizer loaded from %s", path)
+	return tokenizers
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	constant "session-management/const"
+	"session-management/models"
+	"session-management/requests"
+	"session-management/response"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful/v3"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket 命令类型
+const (
+	WSCommandSend       = "send"
+	WSCommandResume     = "resume"
+	WSCommandBreak      = "break"
+	WSCommandRegenerate = "regenerate"
+	WSCommandPing       = "ping"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsMaxMessage   = 1 << 20
+)
+
+var wsUpgrader = websocket.Upgrader{
+	// 与 SSE 接口一致，允许跨域
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsConn 一个会话上的 WebSocket 连接，可以同时推送多个生成
+type wsConn struct {
+	chat      *ChatService
+	conn      *websocket.Conn
+	userID    string
+	sessionID string
+	policy    FlushPolicy
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	writeMu    sync.Mutex             // 同一时间只能有一个写入
+	mu         sync.Mutex             // 保护 deliveries
+	deliveries map[string]*wsDelivery // messageID -> 正在进行的推送
+	wg         sync.WaitGroup
+}
+
+// wsDelivery 一个流的推送
+type wsDelivery struct {
+	cancel context.CancelFunc
+}
+
+// wsSink WebSocket 输出端，事件带上触发它的命令的请求ID
+type wsSink struct {
+	conn      *wsConn
+	requestID string
+}
+
+func (s *wsSink) Send(id string, event string, data map[string]any) error {
+	return s.conn.write(response.WSEvent{Event: event, ID: id, RequestID: s.requestID, Data: data})
+}
+
+// Heartbeat 由连接统一发送 ping 帧，这里不需要单独发送
+func (s *wsSink) Heartbeat(data map[string]any) error {
+	return nil
+}
+
+// ServeSessionWebSocket 会话的 WebSocket 连接
+// 客户端通过命令发起对话、续传、中断和重新生成，同一连接上可以同时进行多个生成
+// 断开连接只停止推送，不影响生成，重连后用 resume 续传
+func (s *ChatService) ServeSessionWebSocket(userID, sessionID string, req *restful.Request, resp *restful.Response) error {
+	// 验证会话归属
+	if _, err := s.sessions.GetSessionById(userID, sessionID); err != nil {
+		return err
+	}
+	policy, err := flushPolicyFromRequest(req)
+	if err != nil {
+		return err
+	}
+
+	conn, err := wsUpgrader.Upgrade(resp.ResponseWriter, req.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已经写入了错误响应
+		log.Printf("websocket upgrade failed: %v", err)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &wsConn{
+		chat:       s,
+		conn:       conn,
+		userID:     userID,
+		sessionID:  sessionID,
+		policy:     policy,
+		ctx:        ctx,
+		cancel:     cancel,
+		deliveries: make(map[string]*wsDelivery),
+	}
+	c.serve()
+	return nil
+}
+
+func (c *wsConn) serve() {
+	defer func() {
+		c.cancel()
+		c.wg.Wait()
+		c.conn.Close()
+	}()
+
+	// 超过两个心跳周期没有收到任何消息（包括 pong）视为断开
+	readTimeout := 2*c.chat.streams.cfg.HeartbeatInterval + wsWriteTimeout
+	c.conn.SetReadLimit(wsMaxMessage)
+	c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+	c.wg.Add(1)
+	go c.pingLoop()
+
+	for {
+		_, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			if !isWSClosed(err) {
+				log.Printf("websocket read for session %s: %v", c.sessionID, err)
+			}
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+		var cmd requests.WSCommandReq
+		if err := json.Unmarshal(payload, &cmd); err != nil {
+			c.writeError("", &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "命令格式错误"})
+			continue
+		}
+		if err := c.handle(&cmd); err != nil {
+			c.writeError(cmd.RequestID, err)
+		}
+	}
+}
+
+// pingLoop 定时发送 ping 帧，防止代理关闭空闲连接
+func (c *wsConn) pingLoop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.chat.streams.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.writeMu.Lock()
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			c.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// handle 处理一条命令，生成类命令启动推送后立即返回
+func (c *wsConn) handle(cmd *requests.WSCommandReq) error {
+	switch cmd.Type {
+	case WSCommandSend:
+		stream, err := c.chat.StartStreamChatInSession(models.StreamChatDto{
+			UserId:    c.userID,
+			SessionId: c.sessionID,
+			LastMsgID: cmd.LastMsgID,
+			ProjectID: cmd.ProjectId,
+			Query:     cmd.QueryInfo.Query,
+			Files:     cmd.QueryInfo.Files,
+		})
+		if err != nil {
+			return err
+		}
+		c.attach(stream, 0, cmd.RequestID)
+
+	case WSCommandRegenerate:
+		stream, err := c.chat.StartRegenerate(c.userID, c.sessionID, cmd.MessageID)
+		if err != nil {
+			return err
+		}
+		c.attach(stream, 0, cmd.RequestID)
+
+	case WSCommandResume:
+		fromChunk := fromChunkLatest
+		if cmd.FromChunk != nil {
+			if *cmd.FromChunk < 0 {
+				return &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "from_chunk不能为负数"}
+			}
+			fromChunk = *cmd.FromChunk
+		}
+		stream, err := c.chat.OpenResumeStream(c.userID, c.sessionID, cmd.MessageID)
+		if err != nil {
+			return err
+		}
+		c.attach(stream, fromChunk, cmd.RequestID)
+
+	case WSCommandBreak:
+		exists, err := c.chat.streams.BreakStream(c.sessionID, cmd.MessageID)
+		if !exists {
+			return constant.ErrStreamNotFound
+		}
+		if err != nil {
+			log.Println("websocket break error:", err)
+			return constant.ErrInternalServer
+		}
+		return c.write(response.WSEvent{Event: "ack", RequestID: cmd.RequestID, Data: map[string]any{
+			"type":       cmd.Type,
+			"message_id": cmd.MessageID,
+		}})
+
+	case WSCommandPing:
+		return c.write(response.WSEvent{Event: "pong", RequestID: cmd.RequestID})
+
+	default:
+		return &response.BizError{HttpStatus: http.StatusBadRequest, Code: 400, Msg: "未知的命令类型: " + cmd.Type}
+	}
+	return nil
+}
+
+// attach 在后台把流推送给客户端；同一条消息再次 attach 时替换之前的推送
+func (c *wsConn) attach(stream *StreamState, fromChunk int, requestID string) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	delivery := &wsDelivery{cancel: cancel}
+	c.mu.Lock()
+	if prev, ok := c.deliveries[stream.MessageID]; ok {
+		prev.cancel()
+	}
+	c.deliveries[stream.MessageID] = delivery
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer cancel()
+		if err := c.chat.streams.deliverStream(ctx, stream, fromChunk, c.policy, &wsSink{conn: c, requestID: requestID}); err != nil {
+			log.Printf("websocket deliver %s failed: %v", stream.MessageID, err)
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// 已经被新的推送替换时不删除
+		if c.deliveries[stream.MessageID] == delivery {
+			delete(c.deliveries, stream.MessageID)
+		}
+	}()
+}
+
+func (c *wsConn) write(ev response.WSEvent) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteJSON(ev)
+}
+
+// writeError 把命令的处理错误发给客户端，不断开连接
+func (c *wsConn) writeError(requestID string, err error) {
+	bizErr, ok := err.(*response.BizError)
+	if !ok {
+		log.Printf("websocket command failed: %v", err)
+		bizErr = &response.BizError{HttpStatus: http.StatusInternalServerError, Code: -1, Msg: "Internal Server Error"}
+	}
+	if err := c.write(response.WSEvent{Event: "error", RequestID: requestID, Data: map[string]any{
+		"code":    bizErr.Code,
+		"message": bizErr.Msg,
+	}}); err != nil {
+		log.Printf("websocket write error event failed: %v", err)
+	}
+}
+
+// isWSClosed 是否为客户端正常关闭或连接已断开
+func isWSClosed(err error) bool {
+	return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) ||
+		errors.Is(err, net.ErrClosed)
+}